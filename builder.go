@@ -7,13 +7,18 @@ package kdb
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
-	"time"
 )
 
+//Find等方法使用的主键字段
+const primaryKey = "id"
+
 type Builder struct {
 	table      string
 	conn       *Connection
@@ -32,6 +37,15 @@ type Builder struct {
 	offset     int
 	limitFlag  bool
 	limit      int
+
+	onlyColumns   []string
+	exceptColumns []string
+	values        []interface{} //更新时与columns一一对应的值
+
+	allowFullTable bool
+
+	lock         string //update或share
+	lockModifier string //nowait或skip locked
 }
 
 type aggregate struct {
@@ -75,6 +89,52 @@ func newBuilder(conn *Connection, grammar *Grammar) *Builder {
 	return b
 }
 
+//深度复制当前的查询构造器,复制后的构造器与原构造器互不影响
+func (b *Builder) Clone() *Builder {
+	nb := *b
+
+	nb.bindings = make(map[string][]interface{}, len(b.bindings))
+	for typ, values := range b.bindings {
+		nb.bindings[typ] = append([]interface{}(nil), values...)
+	}
+
+	if b.agg != nil {
+		agg := *b.agg
+		nb.agg = &agg
+	}
+
+	nb.columns = append([]string(nil), b.columns...)
+	nb.joins = append([]join(nil), b.joins...)
+	nb.wheres = cloneWheres(b.wheres)
+	nb.groups = append([]string(nil), b.groups...)
+	nb.havings = cloneWheres(b.havings)
+	nb.orders = append([]order(nil), b.orders...)
+	nb.values = append([]interface{}(nil), b.values...)
+	nb.onlyColumns = append([]string(nil), b.onlyColumns...)
+	nb.exceptColumns = append([]string(nil), b.exceptColumns...)
+
+	nb.unions = make([]union, len(b.unions))
+	for i, u := range b.unions {
+		nb.unions[i] = union{query: u.query.Clone(), all: u.all}
+	}
+
+	return &nb
+}
+
+func cloneWheres(wheres []where) []where {
+	if wheres == nil {
+		return nil
+	}
+
+	ws := make([]where, len(wheres))
+	for i, w := range wheres {
+		w.values = append([]interface{}(nil), w.values...)
+		ws[i] = w
+	}
+
+	return ws
+}
+
 func (b *Builder) Table(table string) *Builder {
 	b.table = table
 	return b
@@ -90,6 +150,18 @@ func (b *Builder) Select(columns ...string) *Builder {
 	return b
 }
 
+//插入和更新时只处理指定的字段
+func (b *Builder) Only(columns ...string) *Builder {
+	b.onlyColumns = columns
+	return b
+}
+
+//插入和更新时排除指定的字段
+func (b *Builder) Except(columns ...string) *Builder {
+	b.exceptColumns = columns
+	return b
+}
+
 func (b *Builder) Distinct() *Builder {
 	b.distinct = true
 	return b
@@ -213,13 +285,58 @@ func (b *Builder) orWhereIsNull(column interface{}) *Builder {
 	return b
 }
 
+//原生的where条件,例如WhereRaw("(`a`, `b`) > (?, ?)", 1, 2)
+func (b *Builder) WhereRaw(sql string, bindings ...interface{}) *Builder {
+	w := new(where)
+	w.column = sql
+	w.glue = "and"
+	w.typ = "raw"
+	w.values = bindings
+	b.wheres = append(b.wheres, *w)
+	b.addBinding("where", bindings)
+	return b
+}
+
+//已有的条件中包含or时,用括号把它们合并成一个条件,避免之后追加的and条件改变原有条件的优先级
+func (b *Builder) groupWheres() *Builder {
+	hasOr := false
+	for i, w := range b.wheres {
+		if i > 0 && w.glue == "or" {
+			hasOr = true
+			break
+		}
+	}
+
+	if !hasOr {
+		return b
+	}
+
+	w := new(where)
+	w.column = fmt.Sprintf("(%s)", strings.TrimSpace(b.grammar.compileConditions(b)))
+	w.glue = "and"
+	w.typ = "raw"
+	w.values = b.bindings["where"]
+	b.wheres = []where{*w}
+	return b
+}
+
+func (b *Builder) OrWhereRaw(sql string, bindings ...interface{}) *Builder {
+	w := new(where)
+	w.column = sql
+	w.glue = "or"
+	w.typ = "raw"
+	w.values = bindings
+	b.wheres = append(b.wheres, *w)
+	b.addBinding("where", bindings)
+	return b
+}
+
 func (b *Builder) WhereIn(column interface{}, values interface{}) *Builder {
 	w := new(where)
 	w.column = column
 	w.glue = "and"
 	w.typ = "in"
 	w.operator = "in"
-	b.wheres = append(b.wheres, *w)
 
 	v := reflect.ValueOf(values)
 	if v.Kind() == reflect.Slice {
@@ -228,6 +345,7 @@ func (b *Builder) WhereIn(column interface{}, values interface{}) *Builder {
 			w.values[i] = v.Index(i).Interface()
 		}
 	}
+	b.wheres = append(b.wheres, *w)
 	b.addBinding("where", w.values)
 	return b
 }
@@ -238,7 +356,6 @@ func (b *Builder) WhereNotIn(column interface{}, values interface{}) *Builder {
 	w.glue = "and"
 	w.typ = "in"
 	w.operator = "not in"
-	b.wheres = append(b.wheres, *w)
 
 	v := reflect.ValueOf(values)
 	if v.Kind() == reflect.Slice {
@@ -247,6 +364,7 @@ func (b *Builder) WhereNotIn(column interface{}, values interface{}) *Builder {
 			w.values[i] = v.Index(i).Interface()
 		}
 	}
+	b.wheres = append(b.wheres, *w)
 	b.addBinding("where", w.values)
 	return b
 }
@@ -322,6 +440,36 @@ func (b *Builder) Limit(limit int) *Builder {
 	return b
 }
 
+//排他锁,select ... for update,必须在事务中使用
+func (b *Builder) LockForUpdate() *Builder {
+	b.lock = "update"
+	return b
+}
+
+//共享锁,mysql为lock in share mode,postgres为for share,必须在事务中使用
+func (b *Builder) SharedLock() *Builder {
+	b.lock = "share"
+	return b
+}
+
+//跳过已经被锁定的行,没有指定锁时使用排他锁
+func (b *Builder) SkipLocked() *Builder {
+	if b.lock == "" {
+		b.lock = "update"
+	}
+	b.lockModifier = "skip locked"
+	return b
+}
+
+//无法获取锁时立即返回错误,没有指定锁时使用排他锁
+func (b *Builder) NoWait() *Builder {
+	if b.lock == "" {
+		b.lock = "update"
+	}
+	b.lockModifier = "nowait"
+	return b
+}
+
 func (b *Builder) Union(query *Builder, all ...bool) *Builder {
 	var allFlag bool
 	if len(all) > 0 {
@@ -352,6 +500,10 @@ func (b *Builder) Count(columns ...string) (int64, error) {
 		return 0, err
 	}
 
+	if result == "" {
+		return 0, nil
+	}
+
 	return strconv.ParseInt(result, 10, 64)
 }
 
@@ -373,11 +525,13 @@ func (b *Builder) Avg(column string) (interface{}, error) {
 }
 
 func (b *Builder) aggregate(function string, column string) (string, error) {
-	b.columns = b.columns[:0]
-	delete(b.bindings, "select")
+	//在副本上执行,保证当前的查询构造器可以继续复用
+	q := b.Clone()
+	q.columns = nil
+	delete(q.bindings, "select")
 
-	b.setAggregate(function, column)
-	result, err := b.Get(column).ToMap()
+	q.setAggregate(function, column)
+	result, err := q.runSelect().ToMap()
 	if err != nil {
 		return "", err
 	}
@@ -404,27 +558,96 @@ func (b *Builder) setAggregate(function string, column string) *Builder {
 }
 
 func (b *Builder) First(columns ...string) *Row {
-	rs := b.Get(columns...)
+	rs := b.Clone().Limit(1).Get(columns...)
 	r := new(Row)
 	r.rs = rs
 	return r
 }
 
+//根据主键id查询单条数据
+func (b *Builder) Find(id interface{}, columns ...string) *Row {
+	return b.Clone().Where(primaryKey, id).First(columns...)
+}
+
+//判断是否存在满足条件的数据,编译为select exists(...)
+func (b *Builder) Exists() (bool, error) {
+	q := b.Clone()
+	sql := q.grammar.compileExists(q)
+
+	result, err := q.selectSQL(sql, q.getBindings()).ToArray()
+	if err != nil {
+		return false, err
+	}
+
+	if len(result) == 0 || len(result[0]) == 0 {
+		return false, nil
+	}
+
+	return strconv.ParseBool(result[0][0])
+}
+
+func (b *Builder) DoesntExist() (bool, error) {
+	exists, err := b.Exists()
+	return !exists, err
+}
+
+//获取第一行数据中指定字段的值
+func (b *Builder) Value(column string) (string, error) {
+	result, err := b.First(column).ToArray()
+	if err != nil {
+		return "", err
+	}
+
+	return result[0], nil
+}
+
+//获取指定字段的值列表,返回[]string
+//如果指定了keyColumn,则返回以keyColumn的值为key的map[string]string
+func (b *Builder) Pluck(column string, keyColumn ...string) (interface{}, error) {
+	if len(keyColumn) == 0 {
+		result, err := b.Get(column).ToArray()
+		if err != nil {
+			return nil, err
+		}
+
+		values := make([]string, len(result))
+		for i, item := range result {
+			values[i] = item[0]
+		}
+
+		return values, nil
+	}
+
+	result, err := b.Get(column, keyColumn[0]).ToArray()
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string, len(result))
+	for _, item := range result {
+		values[item[1]] = item[0]
+	}
+
+	return values, nil
+}
+
 func (b *Builder) Get(columns ...string) *Rows {
+	q := b.Clone()
 	if len(columns) > 0 {
-		b.Select(columns...)
+		q.Select(columns...)
 	}
-	return b.runSelect()
+	return q.runSelect()
 }
 
 func (b *Builder) Insert(data interface{}) (lastInsertId int64, err error) {
 
-	columns, values, err := b.getInsertMap(data)
+	columns, values, err := b.getInsertMap(data, true)
 	if err != nil {
 		return 0, err
 	}
 
-	b.columns = append(b.columns, columns...)
+	q := b.Clone()
+	q.columns = columns
 
 	bindings := make([]interface{}, len(columns))
 
@@ -432,136 +655,333 @@ func (b *Builder) Insert(data interface{}) (lastInsertId int64, err error) {
 		bindings[i] = values[column][0]
 	}
 
-	b.addBinding("insert", bindings)
+	q.addBinding("insert", bindings)
+
+	if len(q.columns) > 0 {
+		sql := q.grammar.compileInsert(q)
+		lastInsertId, err = q.conn.Insert(sql, q.getBindings())
+		if err != nil {
+			return 0, err
+		}
+
+		//传入的是结构体指针时,把自增id回写到带有auto属性的字段
+		stVal := reflect.ValueOf(data)
+		if stVal.Kind() == reflect.Ptr {
+			setAutoId(stVal.Elem(), lastInsertId)
+		}
 
-	if len(b.columns) > 0 {
-		sql := b.grammar.compileInsert(b)
-		return b.conn.Insert(sql, b.getBindings())
+		return lastInsertId, nil
 	}
 
 	return 0, errors.New("insert data cannot be empty")
 }
 
-func (b *Builder) MultiInsert(data interface{}) (lastInsertId []int64, err error) {
+//将子查询的结果插入到当前表中,insert into t (columns) select ...,返回插入的行数
+func (b *Builder) InsertUsing(columns []string, query *Builder) (affectRows int64, err error) {
+	if query == nil {
+		return 0, errors.New("insert using query cannot be empty")
+	}
+
+	q := b.Clone()
+	q.columns = columns
+
+	sql := q.grammar.compileInsertUsing(q, query)
+	return q.conn.Update(sql, query.getBindings())
+}
+
+//批量插入,按照驱动的占位符数量限制拆分成多条insert into ... values (...),(...)语句
+//inTx为true时,拆分后的多条语句在同一个事务中执行
+//mysql和sqlite返回每一行的自增id,postgres不返回
+func (b *Builder) MultiInsert(data interface{}, inTx ...bool) (lastInsertId []int64, err error) {
 
-	stVal := reflect.ValueOf(data)
+	stVal := reflect.Indirect(reflect.ValueOf(data))
 	if stVal.Kind() != reflect.Slice {
 		return nil, errors.New("data is not []interface{} type")
 	}
 
-	n := stVal.Len()
+	var tx bool
+	if len(inTx) > 0 {
+		tx = inTx[0]
+	}
+
+	q, rows, bindingsArr, err := b.prepareBatchInsert(data)
+	if err != nil {
+		return nil, err
+	}
+
+	queries := make([]string, len(rows))
+	for i, n := range rows {
+		queries[i] = q.grammar.compileBatchInsert(q, n)
+	}
+
+	lastInsertId, err = q.conn.batchInsert(queries, bindingsArr, rows, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	//把自增id依次回写到slice中每个结构体带有auto属性的字段
+	if len(lastInsertId) == stVal.Len() {
+		for i := 0; i < stVal.Len(); i++ {
+			setAutoId(stVal.Index(i), lastInsertId[i])
+		}
+	}
+
+	return lastInsertId, nil
+}
+
+//插入数据,忽略唯一键冲突的行,返回实际插入的行数
+//data支持struct、map以及它们的slice,slice会按照占位符数量限制分批插入
+func (b *Builder) InsertOrIgnore(data interface{}) (affectRows int64, err error) {
+	q, rows, bindingsArr, err := b.prepareBatchInsert(data)
+	if err != nil {
+		return 0, err
+	}
+
+	queries := make([]string, len(rows))
+	for i, n := range rows {
+		queries[i] = q.grammar.compileInsertOrIgnore(q, n)
+	}
 
-	if n > 0 {
-		columns, values, err := b.getInsertMap(data)
+	return q.conn.batchAffected(queries, bindingsArr)
+}
+
+//插入数据,唯一键冲突时更新update中的字段,update为空时更新除uniqueBy外的所有字段
+//mysql使用on duplicate key update,会忽略uniqueBy;postgres和sqlite使用on conflict (uniqueBy) do update
+func (b *Builder) Upsert(data interface{}, uniqueBy []string, update []string) (affectRows int64, err error) {
+	q, rows, bindingsArr, err := b.prepareBatchInsert(data)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(update) == 0 {
+		for _, column := range q.columns {
+			if !inStrings(uniqueBy, column) {
+				update = append(update, column)
+			}
+		}
+	}
+
+	queries := make([]string, len(rows))
+	for i, n := range rows {
+		queries[i], err = q.grammar.compileUpsert(q, n, uniqueBy, update)
 		if err != nil {
-			return nil, err
+			return 0, err
 		}
+	}
 
-		b.columns = append(b.columns, columns...)
+	return q.conn.batchAffected(queries, bindingsArr)
+}
 
-		bindingsArr := make([][]interface{}, n)
+//根据attrs查询数据,存在则使用values更新,不存在则插入attrs和values合并后的数据
+func (b *Builder) UpdateOrInsert(attrs map[string]interface{}, values map[string]interface{}) error {
+	q := b.Clone()
 
-		for i := 0; i < n; i++ {
-			bindings := make([]interface{}, len(columns))
-			for j, column := range columns {
-				bindings[j] = values[column][i]
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		q.Where(k, attrs[k])
+	}
+
+	exists, err := q.Exists()
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		data := make(map[string]interface{}, len(attrs)+len(values))
+		for k, v := range attrs {
+			data[k] = v
+		}
+		for k, v := range values {
+			data[k] = v
+		}
+
+		_, err = b.Insert(data)
+		return err
+	}
+
+	if len(values) == 0 {
+		return nil
+	}
+
+	_, err = q.Update(values)
+	return err
+}
+
+//整理批量插入的数据,按照占位符数量限制拆分,返回每一批的行数和绑定参数
+func (b *Builder) prepareBatchInsert(data interface{}) (q *Builder, rows []int, bindingsArr [][]interface{}, err error) {
+	columns, values, err := b.getInsertMap(data, true)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if len(columns) == 0 {
+		return nil, nil, nil, errors.New("insert data cannot be empty")
+	}
+
+	//插入的行数,每一行都必须包含所有的字段
+	n := 1
+	if stVal := reflect.Indirect(reflect.ValueOf(data)); stVal.Kind() == reflect.Slice {
+		n = stVal.Len()
+	}
+
+	for _, column := range columns {
+		if len(values[column]) != n {
+			return nil, nil, nil, fmt.Errorf("the column `%s` is missing in some of the rows to insert", column)
+		}
+	}
+
+	q = b.Clone()
+	q.columns = columns
+
+	//每条语句最多可以插入的行数
+	size := q.grammar.placeholderLimit() / len(columns)
+	if size < 1 {
+		return nil, nil, nil, errors.New("too many columns to insert")
+	}
+
+	for start := 0; start < n; start += size {
+		end := start + size
+		if end > n {
+			end = n
+		}
+
+		bindings := make([]interface{}, 0, (end-start)*len(columns))
+		for i := start; i < end; i++ {
+			for _, column := range columns {
+				bindings = append(bindings, values[column][i])
 			}
-			bindingsArr[i] = bindings
 		}
 
-		if len(b.columns) > 0 {
-			sql := b.grammar.compileInsert(b)
-			return b.conn.MultiInsert(sql, bindingsArr)
+		bindingsArr = append(bindingsArr, bindings)
+		rows = append(rows, end-start)
+	}
+
+	return q, rows, bindingsArr, nil
+}
+
+func inStrings(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+//提取插入或更新的字段和值,并根据Only和Except过滤字段,isInsert为true时零值字段使用default属性的值
+func (b *Builder) getInsertMap(data interface{}, isInsert bool) (columns []string, values map[string][]interface{}, err error) {
+	columns, values, err = b.extractInsertMap(data, true, isInsert)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(b.onlyColumns) == 0 && len(b.exceptColumns) == 0 {
+		return
+	}
+
+	filtered := make([]string, 0, len(columns))
+	for _, column := range columns {
+		if !b.isWritten(column) {
+			delete(values, column)
+			continue
 		}
+
+		filtered = append(filtered, column)
+	}
+
+	return filtered, values, nil
+}
+
+//字段是否需要写入,即没有被Only和Except排除
+func (b *Builder) isWritten(column string) bool {
+	if len(b.onlyColumns) > 0 && !inStrings(b.onlyColumns, column) {
+		return false
 	}
 
-	return nil, errors.New("insert data cannot be empty")
+	return !inStrings(b.exceptColumns, column)
 }
 
-func (b *Builder) getInsertMap(data interface{}) (columns []string, values map[string][]interface{}, err error) {
+//omitEmpty为false时忽略omitempty属性,批量插入时每一行的字段必须一致
+func (b *Builder) extractInsertMap(data interface{}, omitEmpty, isInsert bool) (columns []string, values map[string][]interface{}, err error) {
 	stValue := reflect.Indirect(reflect.ValueOf(data))
 
 	values = make(map[string][]interface{}, 0)
 	switch stValue.Kind() {
 	case reflect.Struct:
-		var ignore bool
-		for i := 0; i < stValue.NumField(); i++ {
-
-			v := reflect.Indirect(stValue.Field(i))
-
-			//处理嵌套的struct中的db映射字段
-			if v.Kind() == reflect.Struct {
-
-				var ignore bool
-
-				switch v.Interface().(type) {
-				case time.Time:
-					ignore = true
-				case sql.NullTime:
-					ignore = true
-				case sql.NullString:
-					ignore = true
-				case sql.NullBool:
-					ignore = true
-				case sql.NullInt64:
-					ignore = true
-				case sql.NullInt32:
-					ignore = true
-				case sql.NullFloat64:
-					ignore = true
-				}
+		meta, err := getStructMeta(stValue.Type())
+		if err != nil {
+			return nil, nil, err
+		}
 
-				if !ignore {
-					cols, vals, err := b.getInsertMap(v.Interface())
-					if err != nil {
-						return nil, nil, err
-					}
-
-					for _, column := range cols {
-						if _, ok := values[column]; !ok {
-							columns = append(columns, column)
-						}
-					}
-
-					for column, v := range vals {
-						if _, ok := values[column]; ok {
-							values[column] = append(values[column], v...)
-						} else {
-							values[column] = v
-						}
-					}
-				}
+		//多个嵌套结构体中有同名的字段时无法确定写入哪一个值,需要通过Except排除或者修改字段名
+		for column, a := range meta.ambiguous {
+			if a.writable && b.isWritten(column) {
+				return nil, nil, fmt.Errorf("%s:%s is ambiguous in %v", kdb.structTag, column, stValue.Type())
 			}
+		}
 
-			tag := stValue.Type().Field(i).Tag.Get(kdb.structTag)
-			attrList := strings.Split(tag, ";")
-			ignore = false
-
-			if len(attrList) > 1 {
-				for _, attr := range attrList {
-					if attr == "auto" {
-						ignore = true
-						break
-					}
-				}
+		for _, f := range meta.fields {
+			//自增字段和只读字段不插入也不更新
+			if f.auto || f.readonly {
+				continue
 			}
 
-			if ignore {
+			//嵌套的结构体指针为nil时,其中的字段不做处理
+			raw, ok := f.value(stValue)
+			if !ok {
 				continue
 			}
 
-			column := attrList[0]
-			if column != "" {
-				if _, ok := values[column]; ok {
-					values[column] = append(values[column], v.Interface())
-				} else {
-					columns = append(columns, column)
-					values[column] = []interface{}{v.Interface()}
+			v := reflect.Indirect(raw)
+			empty := !v.IsValid() || v.IsZero()
+
+			//空指针对应null
+			var value interface{}
+
+			switch {
+			case empty && isInsert && f.hasDefault:
+				//插入时零值使用default属性的值
+				value = f.defaultValue
+			case empty && f.omitEmpty && omitEmpty:
+				//零值和空指针不插入也不更新
+				continue
+			case !v.IsValid():
+			case f.json:
+				//json属性的字段序列化后写入
+				data, err := json.Marshal(v.Interface())
+				if err != nil {
+					return nil, nil, err
+				}
+				value = string(data)
+			case f.converter != nil:
+				//通过注册的类型转换写入
+				target := v
+				if !f.converterElem {
+					target = raw
 				}
+
+				if value, err = f.converter.value(target); err != nil {
+					return nil, nil, err
+				}
+			default:
+				value = driverValue(v)
 			}
+
+			columns = append(columns, f.column)
+			values[f.column] = []interface{}{value}
 		}
 	case reflect.Map:
+		//map的遍历顺序是随机的,按照key排序保证每次生成的sql一致
 		keys := stValue.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return keys[i].String() < keys[j].String()
+		})
+
 		for _, k := range keys {
 			column := k.String()
 			if _, ok := values[column]; ok {
@@ -576,7 +996,7 @@ func (b *Builder) getInsertMap(data interface{}) (columns []string, values map[s
 		for i := 0; i < n; i++ {
 
 			item := stValue.Index(i)
-			cols, vals, err := b.getInsertMap(item.Interface())
+			cols, vals, err := b.extractInsertMap(item.Interface(), false, isInsert)
 
 			if err != nil {
 				return nil, nil, err
@@ -600,30 +1020,124 @@ func (b *Builder) getInsertMap(data interface{}) (columns []string, values map[s
 	return
 }
 
-func (b *Builder) Update(data map[string]interface{}) (affectRows int64, err error) {
+//更新数据,data支持map和struct
+//struct会忽略带有auto属性和tag为"-"的字段,带有omitempty属性的字段为零值时不更新
+//可以通过Only和Except指定需要更新的字段
+func (b *Builder) Update(data interface{}) (affectRows int64, err error) {
+	q, err := b.prepareUpdate(data)
+	if err != nil {
+		return 0, err
+	}
+
+	sql, err := q.grammar.compileUpdate(q)
+	if err != nil {
+		return 0, err
+	}
+	return q.conn.Update(sql, q.getBindings())
+}
 
-	if len(data) > 0 {
-		bindings := make([]interface{}, len(data))
-		i := 0
-		for k, v := range data {
-			b.columns = append(b.columns, k)
-			bindings[i] = v
-			i++
+//整理更新的字段和绑定参数,返回用于编译update语句的副本
+func (b *Builder) prepareUpdate(data interface{}) (*Builder, error) {
+
+	if reflect.Indirect(reflect.ValueOf(data)).Kind() == reflect.Slice {
+		return nil, errors.New("update data cannot be a slice")
+	}
+
+	columns, values, err := b.getInsertMap(data, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(columns) == 0 {
+		return nil, errors.New("update data cannot be empty")
+	}
+
+	q := b.Clone()
+	q.columns = columns
+	q.values = make([]interface{}, len(columns))
+	bindings := make([]interface{}, 0, len(columns))
+	for i, column := range columns {
+		q.values[i] = values[column][0]
+		//原生表达式直接拼接到sql中,只绑定表达式自身的参数
+		if e, ok := q.values[i].(Expression); ok {
+			bindings = append(bindings, e.bindings...)
+		} else {
+			bindings = append(bindings, q.values[i])
+		}
+	}
+	q.addBinding("update", bindings)
+
+	if err := q.checkFullTable("update"); err != nil {
+		return nil, err
+	}
+
+	return q, nil
+}
+
+//字段自增,update t set column = column + amount,extra为同时需要更新的其他字段
+func (b *Builder) Increment(column string, amount interface{}, extra ...map[string]interface{}) (affectRows int64, err error) {
+	return b.incrementOrDecrement(column, "+", amount, extra)
+}
+
+//字段自减,update t set column = column - amount,extra为同时需要更新的其他字段
+func (b *Builder) Decrement(column string, amount interface{}, extra ...map[string]interface{}) (affectRows int64, err error) {
+	return b.incrementOrDecrement(column, "-", amount, extra)
+}
+
+func (b *Builder) incrementOrDecrement(column string, operator string, amount interface{}, extra []map[string]interface{}) (int64, error) {
+	switch reflect.ValueOf(amount).Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+	default:
+		return 0, fmt.Errorf("the amount %v is not a numeric value", amount)
+	}
+
+	data := make(map[string]interface{})
+	for _, m := range extra {
+		for k, v := range m {
+			data[k] = v
 		}
-		b.addBinding("update", bindings)
-		sql := b.grammar.compileUpdate(b)
-		return b.conn.Update(sql, b.getBindings())
 	}
 
-	return 0, errors.New("update data cannot be empty")
+	data[column] = Raw(fmt.Sprintf("%s %s ?", b.grammar.wrapColumn(column), operator), amount)
 
+	return b.Update(data)
 }
 
 func (b *Builder) Delete() (affectRows int64, err error) {
-	sql := b.grammar.compileDelete(b)
+	if err := b.checkFullTable("delete"); err != nil {
+		return 0, err
+	}
+
+	sql, err := b.grammar.compileDelete(b)
+	if err != nil {
+		return 0, err
+	}
 	return b.conn.Delete(sql, b.getBindings())
 }
 
+//清空表,不受安全模式的限制
+func (b *Builder) Truncate() error {
+	queries, bindingsArr := b.grammar.compileTruncate(b)
+	_, err := b.conn.execBatch(queries, bindingsArr, false)
+	return err
+}
+
+//允许在安全模式下执行没有where条件的update和delete
+func (b *Builder) AllowFullTable() *Builder {
+	b.allowFullTable = true
+	return b
+}
+
+//安全模式下禁止没有where条件的update和delete
+func (b *Builder) checkFullTable(typ string) error {
+	if kdb.safeMode && len(b.wheres) == 0 && !b.allowFullTable {
+		return fmt.Errorf("refusing to %s table `%s` without where conditions in safe mode, use AllowFullTable to force it", typ, b.table)
+	}
+	return nil
+}
+
 func (b *Builder) addBinding(typ string, value []interface{}) {
 	if _, ok := b.bindings[typ]; ok {
 		b.bindings[typ] = append(b.bindings[typ], value...)
@@ -637,7 +1151,15 @@ func (b *Builder) toSQL() string {
 }
 
 func (b *Builder) runSelect() *Rows {
-	return b.conn.Select(b.toSQL(), b.getBindings())
+	return b.selectSQL(b.toSQL(), b.getBindings())
+}
+
+//执行由当前Builder编译的查询语句,所有的查询都需要经过这里检查锁的使用
+func (b *Builder) selectSQL(sql string, bindings []interface{}) *Rows {
+	if b.lock != "" && b.conn.tx == nil {
+		return &Rows{lastError: errors.New("lock for update and shared lock must be used in a transaction")}
+	}
+	return b.conn.Select(sql, bindings)
 }
 
 func (b *Builder) getBindings() (bindings []interface{}) {
@@ -0,0 +1,78 @@
+package kdb
+
+import (
+	"database/sql/driver"
+	"reflect"
+	"testing"
+)
+
+type testOrder struct {
+	Id   int64  `db:"id;auto"`
+	Name string `db:"name"`
+}
+
+func TestMultiInsertStepsIdsByAutoIncrement(t *testing.T) {
+	setupTestDB()
+	setTestRows([]string{"step"}, []driver.Value{int64(2)})
+
+	orders := []testOrder{{Name: "a"}, {Name: "b"}, {Name: "c"}}
+	ids, err := Table("order").MultiInsert(orders)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []int64{testLastInsertId, testLastInsertId + 2, testLastInsertId + 4}
+	if !reflect.DeepEqual(ids, want) {
+		t.Fatalf("got ids %v, want %v", ids, want)
+	}
+
+	for i, order := range orders {
+		if order.Id != want[i] {
+			t.Fatalf("got order %d id %d, want %d", i, order.Id, want[i])
+		}
+	}
+}
+
+type testAddr struct {
+	City string `db:"city"`
+}
+
+type testShipment struct {
+	Id   int64  `db:"id;auto"`
+	Name string `db:"name"`
+	Addr *testAddr
+}
+
+func TestBatchInsertRejectsMissingColumns(t *testing.T) {
+	setupTestDB()
+
+	cases := []interface{}{
+		[]map[string]interface{}{{"a": 1}, {"a": 2, "b": 3}},
+		[]map[string]interface{}{{"a": 1}, {"b": 2}},
+		[]testShipment{{Name: "a", Addr: &testAddr{City: "x"}}, {Name: "b"}},
+	}
+
+	for _, data := range cases {
+		if _, err := Table("order").InsertOrIgnore(data); err == nil {
+			t.Fatalf("InsertOrIgnore(%v) should fail", data)
+		}
+
+		if _, err := Table("order").MultiInsert(data); err == nil {
+			t.Fatalf("MultiInsert(%v) should fail", data)
+		}
+	}
+}
+
+func TestLockOutsideTransaction(t *testing.T) {
+	setupTestDB()
+	setTestRows([]string{"aggregate"}, []driver.Value{int64(1)})
+
+	if _, err := Table("user").LockForUpdate().Exists(); err == nil {
+		t.Fatal("Exists with a lock outside a transaction should fail")
+	}
+
+	var users []testUser
+	if _, err := Table("user").GroupBy("name").SharedLock().Paginate(1, 10, &users); err == nil {
+		t.Fatal("Paginate with a lock outside a transaction should fail")
+	}
+}
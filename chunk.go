@@ -0,0 +1,115 @@
+/**
+ * @Author : nopsky
+ * @Email : cnnopsky@gmail.com
+ * @Date : 2026/10/19 11:05
+ */
+package kdb
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+//按偏移量分块读取数据,每块最多size条,fn返回错误时停止遍历
+//查询必须指定排序,否则分块之间的数据可能重复或遗漏
+func (b *Builder) Chunk(size int, fn func(rows *Rows) error) error {
+	if size < 1 {
+		return errors.New("chunk size must be greater than 0")
+	}
+
+	if len(b.orders) == 0 {
+		return errors.New("you must specify an order by clause when using chunk")
+	}
+
+	for page := 1; ; page++ {
+		rows := b.Clone().Offset((page - 1) * size).Limit(size).Get()
+
+		n, err := eachChunk(rows, fn)
+		if err != nil {
+			return err
+		}
+
+		if n < size {
+			return nil
+		}
+	}
+}
+
+//按照column的值分块读取数据,使用where column > ?代替偏移量,在有并发写入时也不会重复或遗漏
+func (b *Builder) ChunkById(size int, column string, fn func(rows *Rows) error) error {
+	if size < 1 {
+		return errors.New("chunk size must be greater than 0")
+	}
+
+	//结果集中的字段名不带表名
+	alias := column
+	if i := strings.LastIndex(column, "."); i >= 0 {
+		alias = column[i+1:]
+	}
+
+	var lastId interface{}
+
+	for {
+		q := b.Clone()
+		if lastId != nil {
+			q.groupWheres().Where(column, ">", lastId)
+		}
+
+		q.orders = nil
+		rows := q.OrderBy(column).Limit(size).Get()
+		rows.remember(alias)
+
+		n, err := eachChunk(rows, fn)
+		if err != nil {
+			return err
+		}
+
+		if n < size {
+			return nil
+		}
+
+		lastId = rows.history[len(rows.history)-1][0]
+		if lastId == nil {
+			return fmt.Errorf("the chunk column `%s` is not found in the result", alias)
+		}
+
+		if v, ok := lastId.([]byte); ok {
+			lastId = string(v)
+		}
+	}
+}
+
+//逐行遍历查询结果,在fn中通过rows.Scan读取当前行
+func (b *Builder) Each(fn func(rows *Rows) error) error {
+	rows := b.Get()
+
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := fn(rows); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+//执行分块的回调,返回该分块的行数,空的分块不会调用fn
+func eachChunk(rows *Rows, fn func(rows *Rows) error) (int, error) {
+	if rows.rs == nil {
+		return 0, rows.lastError
+	}
+
+	if !rows.prefetch() {
+		rows.Close()
+		return 0, rows.rs.Err()
+	}
+
+	if err := fn(rows); err != nil {
+		rows.Close()
+		return 0, err
+	}
+
+	return rows.drain()
+}
@@ -15,10 +15,17 @@ type DBConfig struct {
 	MaxLifetime  time.Duration
 	MaxIdleConns int
 	MaxOpenConns int
+	//单条语句允许的最大占位符数量,为0时根据驱动自动选择
+	//mysql和postgres为65535,sqlite为999,sqlite 3.32及以上版本可以设置为32766
+	MaxPlaceholders int
 }
 
 type KConfig struct {
 	TablePrefix  string
 	StructTag    string
 	DBConfigList []DBConfig
+	SafeMode     bool //开启后禁止执行没有where条件的update和delete
+	StrictScan   bool //开启后读取到结构体时,查询字段和结构体成员不能一一对应则返回错误
+	//没有tag的结构体成员以及Model使用的命名规则,默认为蛇形命名
+	NamingStrategy NamingStrategy
 }
@@ -6,14 +6,20 @@
 package kdb
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"log"
+	"strconv"
+	"strings"
+	"sync"
 )
 
 type Connection struct {
 	ctx  context.Context
+	db   *sql.DB
 	conn *sql.Conn
 	tx   *sql.Tx
 	name string
@@ -43,7 +49,7 @@ func (c *Connection) Select(query string, bindings []interface{}) *Rows {
 		return &Rows{rs: nil, lastError: err}
 	}
 
-	return &Rows{rs: rows, lastError: err}
+	return &Rows{rs: rows, lastError: err, strict: kdb.strictScan}
 }
 
 func (c *Connection) Insert(query string, bindings []interface{}) (int64, error) {
@@ -99,6 +105,131 @@ func (c *Connection) MultiInsert(query string, bindingsArr [][]interface{}) ([]i
 	return lastInsertIds, nil
 }
 
+//执行多条批量插入的语句,rows为每条语句插入的行数
+//inTx为true并且当前没有开启事务时,所有语句在同一个事务中执行
+func (c *Connection) batchInsert(queries []string, bindingsArr [][]interface{}, rows []int, inTx bool) ([]int64, error) {
+	results, err := c.execBatch(queries, bindingsArr, inTx)
+	if err != nil {
+		return nil, err
+	}
+
+	lastInsertIds := make([]int64, 0)
+
+	switch c.dialect() {
+	case "mysql":
+		//mysql返回的是本批次第一行的自增id,同一条insert ... values语句分配的id是连续的,按照auto_increment_increment依次递增
+		step, err := c.autoIncrementStep()
+		if err != nil {
+			return nil, err
+		}
+
+		for i, rs := range results {
+			firstId, err := rs.LastInsertId()
+			if err != nil {
+				return nil, err
+			}
+			for j := 0; j < rows[i]; j++ {
+				lastInsertIds = append(lastInsertIds, firstId+int64(j)*step)
+			}
+		}
+	case "sqlite":
+		//sqlite返回的是本批次最后一行的rowid
+		for i, rs := range results {
+			lastId, err := rs.LastInsertId()
+			if err != nil {
+				return nil, err
+			}
+			for j := rows[i] - 1; j >= 0; j-- {
+				lastInsertIds = append(lastInsertIds, lastId-int64(j))
+			}
+		}
+	default:
+		//postgres不支持LastInsertId,不返回自增id,需要时使用InsertReturning
+		return nil, nil
+	}
+
+	return lastInsertIds, nil
+}
+
+//缓存每个数据库的auto_increment_increment,key为*sql.DB,value为int64
+var autoIncrementSteps sync.Map
+
+//mysql自增id的步长,每个数据库只查询一次
+func (c *Connection) autoIncrementStep() (int64, error) {
+	if c.db != nil {
+		if step, ok := autoIncrementSteps.Load(c.db); ok {
+			return step.(int64), nil
+		}
+	}
+
+	result, err := (&Row{rs: c.Select("select @@auto_increment_increment as step", nil)}).ToMap()
+	if err != nil {
+		return 0, fmt.Errorf("cannot read auto_increment_increment: %v", err)
+	}
+
+	step, err := strconv.ParseInt(result["step"], 10, 64)
+	if err != nil || step < 1 {
+		return 0, fmt.Errorf("invalid auto_increment_increment `%s`", result["step"])
+	}
+
+	if c.db != nil {
+		autoIncrementSteps.Store(c.db, step)
+	}
+
+	return step, nil
+}
+
+//执行多条语句,返回影响的总行数
+func (c *Connection) batchAffected(queries []string, bindingsArr [][]interface{}) (int64, error) {
+	results, err := c.execBatch(queries, bindingsArr, false)
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, rs := range results {
+		n, err := rs.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		total += n
+	}
+
+	return total, nil
+}
+
+func (c *Connection) execBatch(queries []string, bindingsArr [][]interface{}, inTx bool) ([]sql.Result, error) {
+	if inTx && c.tx == nil && len(queries) > 1 {
+		if err := c.BeginTransaction(); err != nil {
+			return nil, err
+		}
+
+		defer func() {
+			c.tx = nil
+		}()
+
+		results, err := c.execBatch(queries, bindingsArr, false)
+		if err != nil {
+			c.RollBack()
+			return nil, err
+		}
+
+		return results, c.Commit()
+	}
+
+	results := make([]sql.Result, len(queries))
+
+	for i, query := range queries {
+		rs, err := c.exec(query, bindingsArr[i])
+		if err != nil {
+			return nil, err
+		}
+		results[i] = rs
+	}
+
+	return results, nil
+}
+
 func (c *Connection) Update(query string, bindings []interface{}) (int64, error) {
 	rs, err := c.exec(query, bindings)
 
@@ -157,6 +288,8 @@ func (c *Connection) RollBack() error {
 
 func (c *Connection) queryRows(query string, bindings []interface{}) (rows *sql.Rows, err error) {
 
+	query = c.rebind(query)
+
 	log.Println("query:", query, "| bindings:", bindings)
 
 	if c.tx != nil {
@@ -179,6 +312,8 @@ func (c *Connection) queryRows(query string, bindings []interface{}) (rows *sql.
 
 func (c *Connection) exec(query string, bindings []interface{}) (rs sql.Result, err error) {
 
+	query = c.rebind(query)
+
 	log.Println("exec:", query, "| bindings:", bindings)
 
 	if c.tx != nil {
@@ -227,6 +362,7 @@ func (c *Connection) getConn() (*sql.Conn, error) {
 		return nil, err
 	}
 
+	c.db = db
 	c.conn = conn
 
 	return c.conn, nil
@@ -236,8 +372,58 @@ func (c *Connection) Table(table string) *Builder {
 	return c.query().Table(table)
 }
 
+//表名优先使用结构体的TableName方法,否则根据命名规则由类型名转换,会自动加上表前缀
+func (c *Connection) Model(model interface{}) *Builder {
+	return c.Table(modelTableName(model))
+}
+
 func (c *Connection) query() *Builder {
 	g := NewGrammar()
+	g.driver = c.driver()
+	g.maxPlaceholders = m.getConfig(c.name).MaxPlaceholders
 	b := newBuilder(c, g)
 	return b
 }
+
+//postgres使用$1,$2...作为占位符,需要把语句中的?替换掉,引号中的?不做处理
+func (c *Connection) rebind(query string) string {
+	if c.dialect() != "postgres" {
+		return query
+	}
+
+	if !strings.Contains(query, "?") {
+		return query
+	}
+
+	buf := bytes.NewBuffer(make([]byte, 0, len(query)+8))
+	n := 0
+	var quote rune
+
+	for _, r := range query {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"' || r == '`':
+			quote = r
+		case r == '?':
+			n++
+			buf.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		buf.WriteRune(r)
+	}
+
+	return buf.String()
+}
+
+//当前连接使用的驱动名称
+func (c *Connection) driver() string {
+	return m.getConfig(c.name).Driver
+}
+
+//当前连接使用的sql方言,与Grammar使用同样的规则
+func (c *Connection) dialect() string {
+	return dialectOf(c.driver())
+}
@@ -7,7 +7,10 @@ package kdb
 
 import (
 	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
+	"math"
 	"reflect"
 	"strconv"
 	"strings"
@@ -59,99 +62,183 @@ func toString(src interface{}) (dst string, err error) {
 	return
 }
 
-//提取tag信息
-func extractTagInfo(st reflect.Value) (tagList map[string]reflect.Value, err error) {
+var (
+	timeType    = reflect.TypeOf(time.Time{})
+	bytesType   = reflect.TypeOf([]byte(nil))
+	scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+)
 
-	stVal := reflect.Indirect(st)
+//是否作为一个整体读写,非结构体、time.Time、实现了sql.Scanner或driver.Valuer以及注册了转换的类型不需要按照tag展开
+func isScalarType(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
 
-	if stVal.Kind() != reflect.Struct {
-		return nil, fmt.Errorf("the variable type is %v, not a struct", stVal.Kind())
+	if t.Kind() != reflect.Struct {
+		return true
 	}
 
-	tagList = make(map[string]reflect.Value)
+	if _, ok := converters.Load(t); ok {
+		return true
+	}
 
-	for i := 0; i < stVal.NumField(); i++ {
+	ptr := reflect.PtrTo(t)
 
-		//获取结构体成员
-		v := stVal.Field(i)
+	return t == timeType || ptr.Implements(scannerType) || t.Implements(valuerType) || ptr.Implements(valuerType)
+}
 
-		if v.Kind() == reflect.Ptr {
-			//如果没有初始化，则需要先初始化
-			if v.IsNil() {
-				var typ reflect.Type
-				if v.Type().Kind() == reflect.Ptr {
-					typ = v.Type().Elem()
-				} else {
-					typ = v.Type()
-				}
-				vv := reflect.New(typ)
-				v.Set(vv)
+//把字段的值转换成map的key的类型
+func convertKey(src interface{}, keyType reflect.Type) (reflect.Value, error) {
+	if valuer, ok := src.(driver.Valuer); ok {
+		var err error
+		if src, err = valuer.Value(); err != nil {
+			return reflect.Value{}, err
+		}
+	}
+
+	if src == nil {
+		return reflect.Value{}, errors.New("the key column cannot be null")
+	}
+
+	if b, ok := src.([]byte); ok {
+		src = string(b)
+	}
+
+	val := reflect.ValueOf(src)
+
+	if keyType.Kind() == reflect.String {
+		str, err := toString(&src)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return reflect.ValueOf(str).Convert(keyType), nil
+	}
+
+	if str, ok := src.(string); ok {
+		switch keyType.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			i, err := strconv.ParseInt(str, 10, 64)
+			if err != nil {
+				return reflect.Value{}, err
 			}
-			//如果是结构体指针，则在进行提取
-			if v.Elem().Kind() == reflect.Struct {
-				t, err := extractTagInfo(v.Elem())
-				if err != nil {
-					return nil, err
-				}
-
-				for k, ptr := range t {
-					if _, ok := tagList[k]; ok {
-						return nil, fmt.Errorf("%s:%s is exists", kdb.structTag, k)
-					}
-
-					tagList[k] = ptr
-				}
+			return reflect.ValueOf(i).Convert(keyType), nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			u, err := strconv.ParseUint(str, 10, 64)
+			if err != nil {
+				return reflect.Value{}, err
 			}
-		} else if v.Kind() == reflect.Map && v.IsNil() {
-			//如果是map类型，并且没有初始化，则需要初始化一下
-			v.Set(reflect.MakeMap(v.Type()))
-		} else if v.Kind() == reflect.Struct {
-			var ignore bool
-			//以下的类型，会再scan的执行转换，所以不需要二次处理
-			switch v.Interface().(type) {
-			case time.Time:
-				ignore = true
-			case sql.NullTime:
-				ignore = true
-			case sql.NullString:
-				ignore = true
-			case sql.NullBool:
-				ignore = true
-			case sql.NullInt64:
-				ignore = true
-			case sql.NullInt32:
-				ignore = true
-			case sql.NullFloat64:
-				ignore = true
+			return reflect.ValueOf(u).Convert(keyType), nil
+		case reflect.Float32, reflect.Float64:
+			f, err := strconv.ParseFloat(str, 64)
+			if err != nil {
+				return reflect.Value{}, err
 			}
+			return reflect.ValueOf(f).Convert(keyType), nil
+		}
+	}
+
+	if val.Type().ConvertibleTo(keyType) {
+		return val.Convert(keyType), nil
+	}
 
-			if !ignore {
-				t, err := extractTagInfo(v)
-				if err != nil {
-					return nil, err
-				}
-
-				for k, ptr := range t {
-					if _, ok := tagList[k]; ok {
-						return nil, fmt.Errorf("%s:%s is exists", kdb.structTag, k)
-					}
-					tagList[k] = ptr
-				}
+	return reflect.Value{}, fmt.Errorf("cannot convert key %v to %v", val.Type(), keyType)
+}
+
+//根据数据库字段类型转换驱动返回的值
+//驱动使用文本协议时会把所有类型都返回为[]byte,需要根据字段类型再解析一次
+//decimal保持为string,避免转换成float64丢失精度
+func normalizeValue(src interface{}, typeName string) (interface{}, error) {
+	typeName = strings.ToUpper(typeName)
+
+	switch v := src.(type) {
+	case nil:
+		return nil, nil
+	case int64, float64, bool, string, time.Time:
+		return v, nil
+	case float32:
+		return float64(v), nil
+	case []byte:
+		return parseBytes(v, typeName)
+	}
+
+	val := reflect.ValueOf(src)
+	switch val.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32:
+		return val.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return int64(val.Uint()), nil
+	case reflect.Uint64:
+		if val.Uint() > math.MaxInt64 {
+			return val.Uint(), nil
+		}
+		return int64(val.Uint()), nil
+	}
+
+	return src, nil
+}
+
+func parseBytes(b []byte, typeName string) (interface{}, error) {
+	switch typeName {
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "INTEGER", "BIGINT", "YEAR",
+		"UNSIGNED TINYINT", "UNSIGNED SMALLINT", "UNSIGNED MEDIUMINT", "UNSIGNED INT", "UNSIGNED BIGINT",
+		"INT2", "INT4", "INT8", "SERIAL", "BIGSERIAL":
+		if i, err := strconv.ParseInt(string(b), 10, 64); err == nil {
+			return i, nil
+		}
+		return strconv.ParseUint(string(b), 10, 64)
+	case "FLOAT", "DOUBLE", "REAL", "FLOAT4", "FLOAT8":
+		return strconv.ParseFloat(string(b), 64)
+	case "BOOL", "BOOLEAN":
+		return strconv.ParseBool(string(b))
+	case "DATE", "DATETIME", "TIMESTAMP", "TIMESTAMPTZ":
+		for _, layout := range []string{"2006-01-02 15:04:05.999999999", "2006-01-02T15:04:05.999999999Z07:00", "2006-01-02"} {
+			if t, err := time.Parse(layout, string(b)); err == nil {
+				return t, nil
 			}
 		}
+		return string(b), nil
+	case "BLOB", "TINYBLOB", "MEDIUMBLOB", "LONGBLOB", "BINARY", "VARBINARY", "BYTEA", "BIT", "GEOMETRY":
+		return append([]byte(nil), b...), nil
+	default:
+		return string(b), nil
+	}
+}
+
+//把自增id写入到结构体中带有auto属性的整型字段,嵌套的结构体也会处理
+func setAutoId(st reflect.Value, id int64) bool {
+	stVal := reflect.Indirect(st)
+
+	if stVal.Kind() != reflect.Struct || !stVal.CanSet() {
+		return false
+	}
+
+	meta, err := getStructMeta(stVal.Type())
+	if err != nil {
+		return false
+	}
+
+	for _, f := range meta.fields {
+		if !f.auto {
+			continue
+		}
 
-		tagName := stVal.Type().Field(i).Tag.Get(kdb.structTag)
-		if tagName != "" {
-			//tag内容通过";"进行分割
-			attr := strings.Split(tagName, ";")
-			column := attr[0]
-			if _, ok := tagList[column]; ok {
-				return nil, fmt.Errorf("%s:%s is exists", kdb.structTag, tagName)
+		v := fieldByPath(stVal, f.index)
+		if v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
 			}
-			//字段对应结构体成员地址
-			tagList[column] = v
+			v = v.Elem()
+		}
+
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			v.SetInt(id)
+			return true
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			v.SetUint(uint64(id))
+			return true
 		}
 	}
 
-	return
+	return false
 }
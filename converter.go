@@ -0,0 +1,108 @@
+/**
+ * @Author : nopsky
+ * @Email : cnnopsky@gmail.com
+ * @Date : 2026/10/19 21:30
+ */
+package kdb
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+//自定义类型转换,用于没有实现driver.Valuer和sql.Scanner的类型,例如第三方库中的枚举和decimal
+type Converter struct {
+	//写入前把成员的值转换成驱动支持的值,为nil时直接使用成员的值
+	ToDB func(value interface{}) (interface{}, error)
+	//把数据库返回的值写入dest,dest为成员的指针,src为nil时不会调用
+	FromDB func(src interface{}, dest interface{}) error
+}
+
+//注册的类型转换,key为reflect.Type,value为*Converter
+var converters sync.Map
+
+var valuerType = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+
+//注册类型转换,typ为该类型的值,例如kdb.RegisterConverter(Status(0), kdb.Converter{...})
+//同时对该类型的指针生效,注册后该类型的成员不会再作为嵌套的结构体展开
+func RegisterConverter(typ interface{}, converter Converter) {
+	t := reflect.TypeOf(typ)
+
+	converters.Store(t, &converter)
+
+	//已经解析过的结构体需要重新解析
+	structMetaCache.Range(func(key, value interface{}) bool {
+		structMetaCache.Delete(key)
+		return true
+	})
+}
+
+//获取类型对应的转换,指针类型没有注册时使用指向的类型的转换,elem表示转换属于指向的类型
+func lookupConverter(t reflect.Type) (conv *Converter, elem bool) {
+	if c, ok := converters.Load(t); ok {
+		return c.(*Converter), false
+	}
+
+	if t.Kind() == reflect.Ptr {
+		if c, ok := converters.Load(t.Elem()); ok {
+			return c.(*Converter), true
+		}
+	}
+
+	return nil, false
+}
+
+//实现了driver.Valuer的类型由驱动转换,Value定义在指针上时需要传入指针
+func driverValue(v reflect.Value) interface{} {
+	t := v.Type()
+
+	if t.Kind() != reflect.Ptr && !t.Implements(valuerType) && reflect.PtrTo(t).Implements(valuerType) {
+		ptr := reflect.New(t)
+		ptr.Elem().Set(v)
+		return ptr.Interface()
+	}
+
+	return v.Interface()
+}
+
+//读取时通过注册的转换写入成员
+type converterScanner struct {
+	dest reflect.Value
+	conv *Converter
+	elem bool        //dest是指针,转换属于指向的类型
+	src  interface{} //数据库返回的原始值
+}
+
+func (s *converterScanner) Scan(src interface{}) error {
+	s.src = cloneBytes(src)
+	dest := s.dest
+
+	if src == nil {
+		dest.Set(reflect.Zero(dest.Type()))
+		return nil
+	}
+
+	if s.elem {
+		if dest.IsNil() {
+			dest.Set(reflect.New(dest.Type().Elem()))
+		}
+		dest = dest.Elem()
+	}
+
+	if s.conv.FromDB == nil {
+		return fmt.Errorf("the converter of %v has no FromDB", dest.Type())
+	}
+
+	return s.conv.FromDB(src, dest.Addr().Interface())
+}
+
+//写入时通过注册的转换得到驱动支持的值
+func (c *Converter) value(v reflect.Value) (interface{}, error) {
+	if c.ToDB == nil {
+		return driverValue(v), nil
+	}
+
+	return c.ToDB(v.Interface())
+}
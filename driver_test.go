@@ -0,0 +1,147 @@
+package kdb
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"io/ioutil"
+	"log"
+	"sync"
+)
+
+//测试使用的驱动,查询返回setTestRows设置的数据
+const testDriverName = "kdbtest"
+
+var (
+	testOnce sync.Once
+	testMu   sync.Mutex
+	testCols []string
+	testData [][]driver.Value
+
+	testQuery string         //最后一次查询的语句
+	testArgs  []driver.Value //最后一次查询的参数
+)
+
+func setupTestDB() {
+	testOnce.Do(func() {
+		sql.Register(testDriverName, testDriver{})
+		log.SetOutput(ioutil.Discard)
+		RegisterDataBase(KConfig{DBConfigList: []DBConfig{{Driver: testDriverName, Dsn: "test", IsMaster: true}}})
+	})
+}
+
+//设置下一次查询返回的数据,每次查询都会返回同样的数据
+func setTestRows(cols []string, data ...[]driver.Value) {
+	testMu.Lock()
+	defer testMu.Unlock()
+	testCols = cols
+	testData = data
+}
+
+//最后一次查询的语句和参数
+func lastTestQuery() (string, []interface{}) {
+	testMu.Lock()
+	defer testMu.Unlock()
+
+	args := make([]interface{}, len(testArgs))
+	for i, arg := range testArgs {
+		args[i] = arg
+	}
+
+	return testQuery, args
+}
+
+type testDriver struct{}
+
+func (testDriver) Open(string) (driver.Conn, error) {
+	return testConn{}, nil
+}
+
+type testConn struct{}
+
+func (testConn) Prepare(query string) (driver.Stmt, error) {
+	return testStmt{query: query}, nil
+}
+
+func (testConn) Close() error {
+	return nil
+}
+
+func (testConn) Begin() (driver.Tx, error) {
+	return testTx{}, nil
+}
+
+func (testConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	return testTx{}, nil
+}
+
+type testTx struct{}
+
+func (testTx) Commit() error {
+	return nil
+}
+
+func (testTx) Rollback() error {
+	return nil
+}
+
+type testStmt struct {
+	query string
+}
+
+func (testStmt) Close() error {
+	return nil
+}
+
+func (testStmt) NumInput() int {
+	return -1
+}
+
+func (testStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return testResult{}, nil
+}
+
+//插入的第一行的自增id固定为testLastInsertId
+const testLastInsertId = 10
+
+type testResult struct{}
+
+func (testResult) LastInsertId() (int64, error) {
+	return testLastInsertId, nil
+}
+
+func (testResult) RowsAffected() (int64, error) {
+	return 1, nil
+}
+
+func (s testStmt) Query(args []driver.Value) (driver.Rows, error) {
+	testMu.Lock()
+	defer testMu.Unlock()
+	testQuery = s.query
+	testArgs = args
+	return &testRows{cols: testCols, data: testData}, nil
+}
+
+type testRows struct {
+	cols []string
+	data [][]driver.Value
+	i    int
+}
+
+func (r *testRows) Columns() []string {
+	return r.cols
+}
+
+func (r *testRows) Close() error {
+	return nil
+}
+
+func (r *testRows) Next(dest []driver.Value) error {
+	if r.i >= len(r.data) {
+		return io.EOF
+	}
+	copy(dest, r.data[r.i])
+	r.i++
+	return nil
+}
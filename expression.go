@@ -0,0 +1,21 @@
+/**
+ * @Author : nopsky
+ * @Email : cnnopsky@gmail.com
+ * @Date : 2026/10/19 14:36
+ */
+package kdb
+
+//原生的sql表达式,编译时直接拼接到sql中,不作为参数绑定
+type Expression struct {
+	value    string
+	bindings []interface{}
+}
+
+//创建原生表达式,例如Raw("NOW()")或者Raw("`stock` - ?", 1)
+func Raw(value string, bindings ...interface{}) Expression {
+	return Expression{value: value, bindings: bindings}
+}
+
+func (e Expression) String() string {
+	return e.value
+}
@@ -1,6 +1,6 @@
 module kdb
 
-go 1.13
+go 1.18
 
 require (
 	github.com/go-sql-driver/mysql v1.4.1
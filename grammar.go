@@ -7,11 +7,14 @@ package kdb
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"strings"
 )
 
 type Grammar struct {
+	driver          string
+	maxPlaceholders int
 }
 
 func NewGrammar() *Grammar {
@@ -19,30 +22,78 @@ func NewGrammar() *Grammar {
 }
 
 func (g *Grammar) compileSelect(b *Builder) string {
-
-	if len(b.columns) == 0 {
-		b.columns = []string{"*"}
-	}
-
 	return fmt.Sprintf("select %s", strings.TrimSpace(strings.Join(g.compileComponents(b), " ")))
 }
 
-func (g *Grammar) compileUpdate(b *Builder) string {
+func (g *Grammar) compileExists(b *Builder) string {
+	return fmt.Sprintf("select exists(%s) as %s", g.compileSelect(b), g.wrapColumn("exists"))
+}
 
-	var sql string
+//编译update语句,mysql支持join以及单表的order by和limit,postgres和sqlite的join使用update ... from
+func (g *Grammar) compileUpdate(b *Builder) (string, error) {
 
-	comm := ""
-	for _, column := range b.columns {
-		sql = fmt.Sprintf("%s%s %s = %s", strings.TrimSpace(sql), comm, g.wrapTable(column), "?")
-		comm = ","
+	if b.offsetFlag {
+		return "", errors.New("update does not support offset")
 	}
 
-	sql = fmt.Sprintf("update %s set %s %s", g.wrapTable(b.table), sql, g.compileWheres(b))
+	sets := make([]string, len(b.columns))
+	for i, column := range b.columns {
+		//postgres和sqlite的set中不能带表名
+		if g.dialect() != "mysql" {
+			if j := strings.LastIndex(column, "."); j >= 0 {
+				column = column[j+1:]
+			}
+		}
 
-	return sql
+		if i < len(b.values) {
+			if e, ok := b.values[i].(Expression); ok {
+				sets[i] = fmt.Sprintf("%s = %s", g.wrapColumn(column), e.value)
+				continue
+			}
+		}
+		sets[i] = fmt.Sprintf("%s = ?", g.wrapColumn(column))
+	}
+
+	switch g.dialect() {
+	case "postgres", "sqlite":
+		if len(b.orders) > 0 || b.limitFlag {
+			return "", fmt.Errorf("%s does not support order by or limit in update", g.driver)
+		}
+
+		if len(b.joins) > 0 {
+			from, conditions, err := g.compileJoinConditions(b)
+			if err != nil {
+				return "", err
+			}
+
+			sql := fmt.Sprintf("update %s set %s from %s %s", g.wrapTable(b.table), strings.Join(sets, ", "), from, g.compileJoinWheres(b, conditions))
+			return strings.TrimSpace(sql), nil
+		}
+
+		sql := fmt.Sprintf("update %s set %s %s", g.wrapTable(b.table), strings.Join(sets, ", "), g.compileWheres(b))
+		return strings.TrimSpace(sql), nil
+	default:
+		if len(b.joins) > 0 && (len(b.orders) > 0 || b.limitFlag) {
+			return "", errors.New("mysql does not support order by or limit in multiple-table update")
+		}
+
+		sql := fmt.Sprintf("update %s", g.wrapTable(b.table))
+		if len(b.joins) > 0 {
+			sql = fmt.Sprintf("%s %s", sql, g.compileJoins(b))
+		}
+
+		sql = fmt.Sprintf("%s set %s %s", sql, strings.Join(sets, ", "), g.compileWheres(b))
+
+		return g.appendOrderAndLimit(b, sql), nil
+	}
 }
 
 func (g *Grammar) compileInsert(b *Builder) string {
+	return g.compileBatchInsert(b, 1)
+}
+
+//编译插入多行数据的语句,insert into t (a,b) values (?,?),(?,?)
+func (g *Grammar) compileBatchInsert(b *Builder, rows int) string {
 
 	var sql string
 	comm := ""
@@ -53,15 +104,209 @@ func (g *Grammar) compileInsert(b *Builder) string {
 	}
 
 	placeHolder := strings.Repeat("?,", len(b.columns))
+	values := strings.Repeat(fmt.Sprintf("(%s),", placeHolder[:len(placeHolder)-1]), rows)
 
-	sql = fmt.Sprintf("insert into %s (%s) values (%s) ", g.wrapTable(b.table), strings.TrimSpace(sql), placeHolder[:len(placeHolder)-1])
+	sql = fmt.Sprintf("insert into %s (%s) values %s ", g.wrapTable(b.table), strings.TrimSpace(sql), values[:len(values)-1])
 
 	return sql
 }
 
-func (g *Grammar) compileDelete(b *Builder) string {
-	sql := fmt.Sprintf("delete %s %s", g.compileFrom(b), g.compileWheres(b))
-	return strings.TrimSpace(sql)
+//编译insert into t (a,b) select ...语句,没有指定字段时省略字段列表
+func (g *Grammar) compileInsertUsing(b *Builder, query *Builder) string {
+	if len(b.columns) == 0 {
+		return fmt.Sprintf("insert into %s %s", g.wrapTable(b.table), query.toSQL())
+	}
+
+	return fmt.Sprintf("insert into %s (%s) %s", g.wrapTable(b.table), g.wrapColumn(b.columns...), query.toSQL())
+}
+
+func (g *Grammar) compileInsertOrIgnore(b *Builder, rows int) string {
+	sql := g.compileBatchInsert(b, rows)
+
+	switch g.dialect() {
+	case "postgres":
+		return fmt.Sprintf("%s on conflict do nothing", strings.TrimSpace(sql))
+	case "sqlite":
+		return strings.Replace(sql, "insert into", "insert or ignore into", 1)
+	default:
+		return strings.Replace(sql, "insert into", "insert ignore into", 1)
+	}
+}
+
+func (g *Grammar) compileUpsert(b *Builder, rows int, uniqueBy []string, update []string) (string, error) {
+	sql := strings.TrimSpace(g.compileBatchInsert(b, rows))
+
+	sets := make([]string, len(update))
+
+	switch g.dialect() {
+	case "postgres", "sqlite":
+		if len(uniqueBy) == 0 {
+			return "", fmt.Errorf("upsert requires unique columns on %s", g.driver)
+		}
+
+		if len(update) == 0 {
+			return fmt.Sprintf("%s on conflict (%s) do nothing", sql, g.wrapColumn(uniqueBy...)), nil
+		}
+
+		for i, column := range update {
+			sets[i] = fmt.Sprintf("%s = excluded.%s", g.wrapColumn(column), g.wrapColumn(column))
+		}
+
+		return fmt.Sprintf("%s on conflict (%s) do update set %s", sql, g.wrapColumn(uniqueBy...), strings.Join(sets, ", ")), nil
+	default:
+		if len(update) == 0 {
+			return g.compileInsertOrIgnore(b, rows), nil
+		}
+
+		for i, column := range update {
+			sets[i] = fmt.Sprintf("%s = values(%s)", g.wrapColumn(column), g.wrapColumn(column))
+		}
+
+		return fmt.Sprintf("%s on duplicate key update %s", sql, strings.Join(sets, ", ")), nil
+	}
+}
+
+//根据驱动名称判断sql方言
+func (g *Grammar) dialect() string {
+	return dialectOf(g.driver)
+}
+
+//驱动名称对应的数据库方言,未知的驱动按照mysql处理
+func dialectOf(driver string) string {
+	switch driver {
+	case "postgres", "pgx":
+		return "postgres"
+	case "sqlite3", "sqlite":
+		return "sqlite"
+	default:
+		return "mysql"
+	}
+}
+
+//单条语句允许的最大占位符数量
+func (g *Grammar) placeholderLimit() int {
+	if g.maxPlaceholders > 0 {
+		return g.maxPlaceholders
+	}
+
+	switch g.dialect() {
+	case "sqlite":
+		return 999
+	default:
+		return 65535
+	}
+}
+
+//编译delete语句,mysql支持join以及单表的order by和limit,postgres的join使用delete ... using
+func (g *Grammar) compileDelete(b *Builder) (string, error) {
+
+	if b.offsetFlag {
+		return "", errors.New("delete does not support offset")
+	}
+
+	switch g.dialect() {
+	case "postgres", "sqlite":
+		if len(b.orders) > 0 || b.limitFlag {
+			return "", fmt.Errorf("%s does not support order by or limit in delete", g.driver)
+		}
+
+		if len(b.joins) > 0 {
+			if g.dialect() == "sqlite" {
+				return "", errors.New("sqlite does not support join in delete")
+			}
+
+			using, conditions, err := g.compileJoinConditions(b)
+			if err != nil {
+				return "", err
+			}
+
+			sql := fmt.Sprintf("delete %s using %s %s", g.compileFrom(b), using, g.compileJoinWheres(b, conditions))
+			return strings.TrimSpace(sql), nil
+		}
+
+		sql := fmt.Sprintf("delete %s %s", g.compileFrom(b), g.compileWheres(b))
+		return strings.TrimSpace(sql), nil
+	default:
+		if len(b.joins) > 0 {
+			if len(b.orders) > 0 || b.limitFlag {
+				return "", errors.New("mysql does not support order by or limit in multiple-table delete")
+			}
+
+			sql := fmt.Sprintf("delete %s %s %s %s", g.wrapTable(b.table), g.compileFrom(b), g.compileJoins(b), g.compileWheres(b))
+			return strings.TrimSpace(sql), nil
+		}
+
+		sql := fmt.Sprintf("delete %s %s", g.compileFrom(b), g.compileWheres(b))
+
+		return g.appendOrderAndLimit(b, sql), nil
+	}
+}
+
+//编译returning子句,没有指定字段时返回所有字段
+func (g *Grammar) compileReturning(columns []string) string {
+	if len(columns) == 0 {
+		return "returning *"
+	}
+
+	return fmt.Sprintf("returning %s", g.wrapColumn(columns...))
+}
+
+//清空表,sqlite不支持truncate,使用不带条件的delete代替
+func (g *Grammar) compileTruncate(b *Builder) (queries []string, bindingsArr [][]interface{}) {
+	table := g.wrapTable(b.table)
+
+	switch g.dialect() {
+	case "postgres":
+		queries = []string{fmt.Sprintf("truncate table %s restart identity", table)}
+		bindingsArr = [][]interface{}{nil}
+	case "sqlite":
+		queries = []string{fmt.Sprintf("delete from %s", table)}
+		bindingsArr = [][]interface{}{nil}
+	default:
+		queries = []string{fmt.Sprintf("truncate table %s", table)}
+		bindingsArr = [][]interface{}{nil}
+	}
+
+	return
+}
+
+func (g *Grammar) appendOrderAndLimit(b *Builder, sql string) string {
+	sql = strings.TrimSpace(sql)
+
+	if len(b.orders) > 0 {
+		sql = fmt.Sprintf("%s %s", sql, g.compileOrders(b))
+	}
+
+	if b.limitFlag {
+		sql = fmt.Sprintf("%s %s", sql, g.compileLimit(b))
+	}
+
+	return sql
+}
+
+//将inner join转换成from/using的表列表和where中的关联条件,其他类型的join无法转换
+func (g *Grammar) compileJoinConditions(b *Builder) (tables string, conditions []string, err error) {
+	list := make([]string, len(b.joins))
+	for i, j := range b.joins {
+		if j.typ != "inner" {
+			return "", nil, fmt.Errorf("%s only supports inner join in update and delete", g.driver)
+		}
+		list[i] = g.wrapTable(j.table)
+		conditions = append(conditions, fmt.Sprintf("%s %s %s", g.wrapColumn(j.column), j.operator, g.wrapColumn(j.value)))
+	}
+
+	return strings.Join(list, ", "), conditions, nil
+}
+
+//关联条件在前,查询条件在后,与绑定参数的顺序一致
+func (g *Grammar) compileJoinWheres(b *Builder, conditions []string) string {
+	sql := strings.Join(conditions, " and ")
+
+	if len(b.wheres) > 0 {
+		sql = fmt.Sprintf("%s and (%s)", sql, g.compileConditions(b))
+	}
+
+	return fmt.Sprintf("where %s", sql)
 }
 
 func (g *Grammar) compileComponents(b *Builder) []string {
@@ -71,7 +316,7 @@ func (g *Grammar) compileComponents(b *Builder) []string {
 		sql = append(sql, g.compileAggregate(b))
 	}
 
-	if len(b.columns) > 0 && b.agg == nil {
+	if b.agg == nil {
 		sql = append(sql, g.compileColumns(b))
 	}
 
@@ -102,12 +347,18 @@ func (g *Grammar) compileComponents(b *Builder) []string {
 		sql = append(sql, g.compileOrders(b))
 	}
 
+	if b.limitFlag {
+		sql = append(sql, g.compileLimit(b))
+	}
+
 	if b.offsetFlag {
 		sql = append(sql, g.compileOffset(b))
 	}
 
-	if b.limitFlag {
-		sql = append(sql, g.compileLimit(b))
+	if b.lock != "" {
+		if lock := g.compileLock(b); lock != "" {
+			sql = append(sql, lock)
+		}
 	}
 
 	if len(b.unions) > 0 {
@@ -116,6 +367,33 @@ func (g *Grammar) compileComponents(b *Builder) []string {
 	return sql
 }
 
+//sqlite不支持行锁,直接忽略
+func (g *Grammar) compileLock(b *Builder) string {
+	var sql string
+
+	switch g.dialect() {
+	case "sqlite":
+		return ""
+	case "postgres":
+		sql = fmt.Sprintf("for %s", b.lock)
+	default:
+		sql = "for update"
+		if b.lock == "share" {
+			//mysql 8之前不支持for share,只有在需要nowait或skip locked时才使用
+			sql = "lock in share mode"
+			if b.lockModifier != "" {
+				sql = "for share"
+			}
+		}
+	}
+
+	if b.lockModifier != "" {
+		sql = fmt.Sprintf("%s %s", sql, b.lockModifier)
+	}
+
+	return sql
+}
+
 func (g *Grammar) compileAggregate(b *Builder) string {
 	column := b.agg.column
 	if b.distinct && b.agg.column != "*" {
@@ -127,11 +405,16 @@ func (g *Grammar) compileAggregate(b *Builder) string {
 
 func (g *Grammar) compileColumns(b *Builder) string {
 
+	columns := b.columns
+	if len(columns) == 0 {
+		columns = []string{"*"}
+	}
+
 	if b.distinct {
-		return fmt.Sprintf("distinct %s", g.wrapColumn(b.columns...))
+		return fmt.Sprintf("distinct %s", g.wrapColumn(columns...))
 	}
 
-	return g.wrapColumn(b.columns...)
+	return g.wrapColumn(columns...)
 
 }
 
@@ -141,15 +424,22 @@ func (g *Grammar) compileFrom(b *Builder) string {
 
 func (g *Grammar) compileJoins(b *Builder) string {
 	var sql string
-	comm := ""
 	for _, v := range b.joins {
-		sql = fmt.Sprintf("%s %s %s join %s on %s %s %s", strings.TrimSpace(sql), comm, v.typ, g.wrapTable(v.table), g.wrapColumn(v.column), v.operator, g.wrapColumn(v.value))
-		comm = v.glue
+		sql = fmt.Sprintf("%s %s join %s on %s %s %s", strings.TrimSpace(sql), v.typ, g.wrapTable(v.table), g.wrapColumn(v.column), v.operator, g.wrapColumn(v.value))
 	}
 	return strings.TrimSpace(sql)
 }
 
 func (g *Grammar) compileWheres(b *Builder) string {
+	if len(b.wheres) == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("where %s", g.compileConditions(b))
+}
+
+//编译where条件,不包含where关键字
+func (g *Grammar) compileConditions(b *Builder) string {
 
 	var sql string
 
@@ -164,12 +454,23 @@ func (g *Grammar) compileWheres(b *Builder) string {
 		case "null":
 			sql = fmt.Sprintf("%s %s %s %s %s", strings.TrimSpace(sql), w.glue, g.wrapColumn(w.column.(string)), w.operator, w.value)
 		case "in":
+			//空的in条件无法编译,in永远为假,not in永远为真
+			if len(w.values) == 0 {
+				empty := "0 = 1"
+				if w.operator == "not in" {
+					empty = "1 = 1"
+				}
+				sql = fmt.Sprintf("%s %s %s", strings.TrimSpace(sql), w.glue, empty)
+				continue
+			}
 			placeHolder := strings.Repeat("?,", len(w.values))
 			sql = fmt.Sprintf("%s %s %s %s (%s)", strings.TrimSpace(sql), w.glue, g.wrapColumn(w.column.(string)), w.operator, placeHolder[:len(placeHolder)-1])
+		case "raw":
+			sql = fmt.Sprintf("%s %s %s", strings.TrimSpace(sql), w.glue, w.column.(string))
 		}
 	}
 
-	return fmt.Sprintf("where %s", strings.TrimSpace(sql))
+	return strings.TrimSpace(sql)
 }
 
 func (g *Grammar) compileGroups(b *Builder) string {
@@ -232,16 +533,18 @@ func (g *Grammar) wrapTable(table string) string {
 }
 
 func (g *Grammar) wrapColumn(columns ...string) string {
+	//不能直接修改传入的slice,否则会改写Builder中的字段
+	columns = append([]string(nil), columns...)
 	for i, column := range columns {
 		segments := strings.Split(column, ".")
 		if len(segments) > 1 {
 			segments[0] = g.wrapTable(segments[0])
 			if segments[1] != "*" && !strings.Contains(segments[0], "->") {
-				segments[1] = fmt.Sprintf("`%s`", segments[1])
+				segments[1] = g.wrapValue(segments[1])
 			}
 		} else {
 			if segments[0] != "*" && !strings.Contains(segments[0], "->") {
-				segments[0] = fmt.Sprintf("`%s`", segments[0])
+				segments[0] = g.wrapValue(segments[0])
 			}
 		}
 		column = strings.Join(segments, ".")
@@ -249,3 +552,11 @@ func (g *Grammar) wrapColumn(columns ...string) string {
 	}
 	return fmt.Sprintf("%s", strings.Join(columns, ", "))
 }
+
+//给字段名加上引号,postgres使用双引号,其他使用反引号
+func (g *Grammar) wrapValue(value string) string {
+	if g.dialect() == "postgres" {
+		return fmt.Sprintf("\"%s\"", value)
+	}
+	return fmt.Sprintf("`%s`", value)
+}
@@ -0,0 +1,161 @@
+package kdb
+
+import (
+	"reflect"
+	"testing"
+)
+
+func newTestBuilder(driver string) *Builder {
+	setupTestDB()
+	return newBuilder(newConnection(), &Grammar{driver: driver}).Table("user")
+}
+
+func TestCompileUpdate(t *testing.T) {
+	joined := func(b *Builder) *Builder {
+		return b.InnerJoin("role", "role.id", "=", "user.role_id").Where("role.name", "admin")
+	}
+	ordered := func(b *Builder) *Builder {
+		return b.Where("status", 0).OrderBy("id").Limit(10)
+	}
+
+	cases := []struct {
+		driver   string
+		build    func(b *Builder) *Builder
+		data     map[string]interface{}
+		sql      string
+		bindings []interface{}
+		err      bool
+	}{
+		{
+			driver: "mysql", build: joined, data: map[string]interface{}{"user.status": 1},
+			sql:      "update user inner join role on role.`id` = user.`role_id` set user.`status` = ? where role.`name` = ?",
+			bindings: []interface{}{1, "admin"},
+		},
+		{
+			driver: "postgres", build: joined, data: map[string]interface{}{"user.status": 1},
+			sql:      `update user set "status" = ? from role where role."id" = user."role_id" and (role."name" = ?)`,
+			bindings: []interface{}{1, "admin"},
+		},
+		{
+			driver: "sqlite3", build: joined, data: map[string]interface{}{"user.status": 1},
+			sql:      "update user set `status` = ? from role where role.`id` = user.`role_id` and (role.`name` = ?)",
+			bindings: []interface{}{1, "admin"},
+		},
+		{
+			driver: "mysql", build: ordered, data: map[string]interface{}{"status": 1},
+			sql:      "update user set `status` = ? where `status` = ? order by `id` asc limit 10",
+			bindings: []interface{}{1, 0},
+		},
+		{driver: "postgres", build: ordered, data: map[string]interface{}{"status": 1}, err: true},
+		{driver: "sqlite3", build: ordered, data: map[string]interface{}{"status": 1}, err: true},
+		{
+			driver: "mysql",
+			build: func(b *Builder) *Builder {
+				return joined(b).OrderBy("id")
+			},
+			data: map[string]interface{}{"user.status": 1},
+			err:  true,
+		},
+		{
+			driver: "postgres",
+			build: func(b *Builder) *Builder {
+				return b.LeftJoin("role", "role.id", "=", "user.role_id").Where("id", 1)
+			},
+			data: map[string]interface{}{"status": 1},
+			err:  true,
+		},
+	}
+
+	for i, c := range cases {
+		q, err := c.build(newTestBuilder(c.driver)).prepareUpdate(c.data)
+		if err != nil {
+			t.Fatalf("case %d: %v", i, err)
+		}
+
+		sql, err := q.grammar.compileUpdate(q)
+		if c.err {
+			if err == nil {
+				t.Errorf("case %d: %s should fail, got %s", i, c.driver, sql)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("case %d: %v", i, err)
+		}
+
+		if bindings := q.getBindings(); sql != c.sql || !reflect.DeepEqual(bindings, c.bindings) {
+			t.Errorf("case %d: got %s %v, want %s %v", i, sql, bindings, c.sql, c.bindings)
+		}
+	}
+}
+
+func TestCompileDelete(t *testing.T) {
+	joined := func(b *Builder) *Builder {
+		return b.InnerJoin("role", "role.id", "=", "user.role_id").Where("role.name", "admin")
+	}
+	ordered := func(b *Builder) *Builder {
+		return b.Where("status", 0).OrderBy("id", "desc").Limit(5)
+	}
+
+	cases := []struct {
+		driver   string
+		build    func(b *Builder) *Builder
+		sql      string
+		bindings []interface{}
+		err      bool
+	}{
+		{
+			driver: "mysql", build: joined,
+			sql:      "delete user from user inner join role on role.`id` = user.`role_id` where role.`name` = ?",
+			bindings: []interface{}{"admin"},
+		},
+		{
+			driver: "postgres", build: joined,
+			sql:      `delete from user using role where role."id" = user."role_id" and (role."name" = ?)`,
+			bindings: []interface{}{"admin"},
+		},
+		{driver: "sqlite3", build: joined, err: true},
+		{
+			driver: "mysql", build: ordered,
+			sql:      "delete from user where `status` = ? order by `id` desc limit 5",
+			bindings: []interface{}{0},
+		},
+		{driver: "postgres", build: ordered, err: true},
+		{driver: "sqlite3", build: ordered, err: true},
+		{
+			driver: "mysql",
+			build: func(b *Builder) *Builder {
+				return joined(b).Limit(1)
+			},
+			err: true,
+		},
+		{
+			driver: "mysql",
+			build: func(b *Builder) *Builder {
+				return b.Where("id", 1).Offset(10)
+			},
+			err: true,
+		},
+	}
+
+	for i, c := range cases {
+		b := c.build(newTestBuilder(c.driver))
+
+		sql, err := b.grammar.compileDelete(b)
+		if c.err {
+			if err == nil {
+				t.Errorf("case %d: %s should fail, got %s", i, c.driver, sql)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("case %d: %v", i, err)
+		}
+
+		if bindings := b.getBindings(); sql != c.sql || !reflect.DeepEqual(bindings, c.bindings) {
+			t.Errorf("case %d: got %s %v, want %s %v", i, sql, bindings, c.sql, c.bindings)
+		}
+	}
+}
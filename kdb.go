@@ -15,6 +15,9 @@ var kdb *engine
 type engine struct {
 	tablePrefix string
 	structTag   string
+	safeMode    bool
+	naming      NamingStrategy
+	strictScan  bool
 }
 
 func RegisterDataBase(kConf KConfig) {
@@ -38,15 +41,28 @@ func RegisterDataBase(kConf KConfig) {
 		if dbConf.Name == "" {
 			dbConf.Name = defaultGroupName
 		}
-		m.addDB(dbConf.Name, dbConf.IsMaster, db)
+		m.addDB(dbConf.Name, dbConf.IsMaster, db, dbConf)
 	}
 
 	kdb = new(engine)
 	kdb.tablePrefix = kConf.TablePrefix
+	kdb.safeMode = kConf.SafeMode
+	kdb.strictScan = kConf.StrictScan
 	kdb.structTag = "db"
 	if kConf.StructTag != "" {
 		kdb.structTag = kConf.StructTag
 	}
+
+	kdb.naming = SnakeNaming{}
+	if kConf.NamingStrategy != nil {
+		kdb.naming = kConf.NamingStrategy
+	}
+
+	//tag和命名规则可能发生变化,需要重新解析结构体
+	structMetaCache.Range(func(key, value interface{}) bool {
+		structMetaCache.Delete(key)
+		return true
+	})
 }
 
 func Select(query string, bindings ...interface{}) *Rows {
@@ -93,3 +109,8 @@ func BeginTransaction() (conn *Connection, err error) {
 func Table(table string) *Builder {
 	return newConnection().Table(table)
 }
+
+//根据结构体查询对应的表,例如kdb.Model(&User{})查询users表
+func Model(model interface{}) *Builder {
+	return newConnection().Model(model)
+}
@@ -18,17 +18,24 @@ const defaultGroupName = "mysql"
 var m = newManager()
 
 type manager struct {
-	dbs map[string]map[string][]*sql.DB
+	dbs     map[string]map[string][]*sql.DB
+	configs map[string]DBConfig
 }
 
 func newManager() *manager {
 	m := new(manager)
 	m.dbs = make(map[string]map[string][]*sql.DB)
+	m.configs = make(map[string]DBConfig)
 	return m
 }
 
 //添加数据库
-func (m *manager) addDB(groupName string, isMaster bool, db *sql.DB) {
+func (m *manager) addDB(groupName string, isMaster bool, db *sql.DB, conf DBConfig) {
+
+	//同一个分组的主从库使用相同的驱动,以第一个配置为准
+	if _, ok := m.configs[groupName]; !ok {
+		m.configs[groupName] = conf
+	}
 
 	dc := "master"
 	if !isMaster {
@@ -84,3 +91,12 @@ func (m *manager) getReadDB(names ...string) (*sql.DB, error) {
 	name := fmt.Sprintf("%s::%s", groupName, "slave")
 	return m.getDB(name)
 }
+
+//获取分组的配置
+func (m *manager) getConfig(names ...string) DBConfig {
+	groupName := defaultGroupName
+	if len(names) > 0 && names[0] != "" {
+		groupName = strings.Split(names[0], "::")[0]
+	}
+	return m.configs[groupName]
+}
@@ -0,0 +1,404 @@
+/**
+ * @Author : nopsky
+ * @Email : cnnopsky@gmail.com
+ * @Date : 2026/10/19 18:40
+ */
+package kdb
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+//结构体中一个映射到数据库字段的成员
+type fieldMeta struct {
+	column    string
+	index     []int //成员的索引路径,嵌套的结构体会展开
+	auto      bool  //自增字段,插入和更新时忽略
+	omitEmpty bool  //零值和空指针不插入也不更新
+	readonly  bool  //只读字段,例如计算列,只在查询时读取
+	json      bool  //以json格式保存,写入时序列化,读取时反序列化
+
+	hasDefault   bool
+	defaultValue string //插入时为零值则使用的值
+
+	converter     *Converter //注册的类型转换
+	converterElem bool       //成员是指针,转换属于指向的类型
+
+	depth    int  //嵌套的层数,同名的字段使用层数最少的成员
+	prefixed bool //字段名来自嵌套结构体的prefix属性
+}
+
+//结构体类型的元数据,按照类型缓存,扫描和插入、更新共用
+type structMeta struct {
+	fields  []*fieldMeta //按照结构体中定义的顺序
+	columns map[string]*fieldMeta
+	aliases map[string]*fieldMeta //带有结构体名的字段,例如user.id,只在查询时使用
+
+	ambiguous map[string]ambiguity //同一层中有多个嵌套结构体包含的字段名
+}
+
+//有歧义的字段所在的层数,以及其中是否有插入和更新时需要写入的成员
+type ambiguity struct {
+	depth    int
+	writable bool
+}
+
+type structMetaKey struct {
+	typ reflect.Type
+	tag string
+}
+
+//缓存解析过的结构体,key为structMetaKey,value为*structMeta
+var structMetaCache sync.Map
+
+//获取结构体类型的元数据,第一次使用时解析tag并缓存
+func getStructMeta(t reflect.Type) (*structMeta, error) {
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("the variable type is %v, not a struct", t.Kind())
+	}
+
+	key := structMetaKey{typ: t, tag: kdb.structTag}
+	if meta, ok := structMetaCache.Load(key); ok {
+		return meta.(*structMeta), nil
+	}
+
+	meta, err := buildStructMeta(t, map[reflect.Type]bool{t: true})
+	if err != nil {
+		return nil, err
+	}
+
+	actual, _ := structMetaCache.LoadOrStore(key, meta)
+
+	return actual.(*structMeta), nil
+}
+
+func buildStructMeta(t reflect.Type, visiting map[reflect.Type]bool) (*structMeta, error) {
+	m := &structMeta{
+		columns:   make(map[string]*fieldMeta),
+		aliases:   make(map[string]*fieldMeta),
+		ambiguous: make(map[string]ambiguity),
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tagName := field.Tag.Get(kdb.structTag)
+
+		//tag为"-"的字段不做映射
+		if tagName == "-" {
+			continue
+		}
+
+		//未导出的成员无法赋值,只有匿名的结构体可以展开其中导出的成员
+		exported := field.PkgPath == ""
+		if !exported && !field.Anonymous {
+			continue
+		}
+
+		nested := field.Type
+		if nested.Kind() == reflect.Ptr && exported {
+			nested = nested.Elem()
+		}
+
+		//tag内容通过";"进行分割
+		attrList := strings.Split(tagName, ";")
+
+		//没有tag或者tag中没有字段名时,例如`db:";omitempty"`,根据命名规则把成员名转换成字段名
+		column := attrList[0]
+		if column == "" {
+			column = kdb.naming.ColumnName(field.Name)
+		}
+
+		f := &fieldMeta{column: column, index: []int{i}}
+		f.converter, f.converterElem = lookupConverter(field.Type)
+
+		var prefix string
+		var hasPrefix bool
+
+		for _, attr := range attrList[1:] {
+			switch {
+			case attr == "auto":
+				f.auto = true
+			case attr == "omitempty":
+				f.omitEmpty = true
+			case attr == "readonly":
+				f.readonly = true
+			case attr == "json":
+				f.json = true
+			case strings.HasPrefix(attr, "default:"):
+				f.hasDefault = true
+				f.defaultValue = strings.TrimPrefix(attr, "default:")
+			case strings.HasPrefix(attr, "prefix:"):
+				hasPrefix = true
+				prefix = strings.TrimPrefix(attr, "prefix:")
+			}
+		}
+
+		//json属性的字段整体保存在一个字段中,time.Time、sql.NullString等类型在scan时直接转换,都不需要展开
+		isNested := !f.json && nested.Kind() == reflect.Struct && !isScalarType(nested)
+
+		//自引用的结构体不再展开
+		if isNested && !visiting[nested] {
+			visiting[nested] = true
+			sub, err := buildStructMeta(nested, visiting)
+			delete(visiting, nested)
+			if err != nil {
+				return nil, err
+			}
+
+			if err := m.merge(sub, i, field, column, hasPrefix, prefix); err != nil {
+				return nil, err
+			}
+		}
+
+		if !exported {
+			continue
+		}
+
+		//没有tag或者指定了prefix的嵌套结构体只展开其中的成员,本身不对应字段
+		if isNested && (tagName == "" || hasPrefix) {
+			continue
+		}
+
+		//命名规则返回空字符串时不映射
+		if f.column == "" {
+			continue
+		}
+
+		//没有tag的slice、map等类型无法直接作为字段的值,不做映射
+		if tagName == "" && !isColumnType(field.Type) {
+			continue
+		}
+
+		if err := m.add(f); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+//是否可以作为字段的值,[]byte以及实现了driver.Valuer、sql.Scanner或者注册了转换的类型都可以
+func isColumnType(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Func, reflect.Chan, reflect.Interface:
+	default:
+		return true
+	}
+
+	if t == bytesType {
+		return true
+	}
+
+	if _, ok := converters.Load(t); ok {
+		return true
+	}
+
+	ptr := reflect.PtrTo(t)
+
+	return t.Implements(valuerType) || ptr.Implements(valuerType) || ptr.Implements(scannerType)
+}
+
+//合并嵌套结构体的字段
+//指定了prefix时字段名加上前缀,这些字段通常属于关联的表,只在查询时读取
+//非匿名的结构体同时可以通过"结构体字段名.字段名"读取,例如select u.id as "user.id"
+func (m *structMeta) merge(sub *structMeta, i int, field reflect.StructField, qualifier string, hasPrefix bool, prefix string) error {
+	nested := make(map[*fieldMeta]*fieldMeta, len(sub.fields))
+
+	//把嵌套结构体的字段转换成当前结构体的字段
+	lift := func(sf *fieldMeta) *fieldMeta {
+		if f, ok := nested[sf]; ok {
+			return f
+		}
+
+		f := *sf
+		f.index = append([]int{i}, sf.index...)
+		f.depth = sf.depth + 1
+
+		if hasPrefix {
+			f.column = prefix + sf.column
+			f.readonly = true
+			f.prefixed = true
+		}
+
+		nested[sf] = &f
+		return &f
+	}
+
+	//嵌套结构体中有歧义的字段在当前结构体中同样有歧义
+	//prefix生成的字段是只读的
+	for column, a := range sub.ambiguous {
+		if hasPrefix {
+			column = prefix + column
+		}
+		m.markAmbiguous(column, a.depth+1, a.writable && !hasPrefix)
+	}
+
+	for _, sf := range sub.fields {
+		if err := m.add(lift(sf)); err != nil {
+			return err
+		}
+	}
+
+	//命名规则没有返回字段名时,只有匿名结构体中的别名可以使用
+	qualified := !field.Anonymous && qualifier != ""
+
+	for alias, sf := range sub.aliases {
+		if field.Anonymous {
+			m.aliases[alias] = lift(sf)
+		} else if qualified {
+			m.aliases[qualifier+"."+alias] = lift(sf)
+		}
+	}
+
+	if qualified {
+		for column, sf := range sub.columns {
+			m.aliases[qualifier+"."+column] = lift(sf)
+		}
+	}
+
+	return nil
+}
+
+//添加字段,同名的字段层数少的优先
+//同一层的两个嵌套结构体中有同名字段时,该字段名有歧义,不做映射,只能通过user.id这样的别名读取,插入和更新时返回错误
+//当前结构体自身的成员重名,或者prefix生成的字段名与其他字段重名时返回错误
+func (m *structMeta) add(f *fieldMeta) error {
+	if a, ok := m.ambiguous[f.column]; ok {
+		if f.depth == a.depth {
+			m.markAmbiguous(f.column, f.depth, f.writable())
+		}
+		if f.depth >= a.depth {
+			return nil
+		}
+		delete(m.ambiguous, f.column)
+	}
+
+	exists, ok := m.columns[f.column]
+	if !ok {
+		m.fields = append(m.fields, f)
+		m.columns[f.column] = f
+		return nil
+	}
+
+	if exists.prefixed || f.prefixed || (exists.depth == 0 && f.depth == 0) {
+		return fmt.Errorf("%s:%s is exists", kdb.structTag, f.column)
+	}
+
+	if exists.depth == f.depth {
+		m.markAmbiguous(f.column, f.depth, exists.writable() || f.writable())
+		return nil
+	}
+
+	if exists.depth < f.depth {
+		return nil
+	}
+
+	for j, field := range m.fields {
+		if field == exists {
+			m.fields[j] = f
+			break
+		}
+	}
+	m.columns[f.column] = f
+
+	return nil
+}
+
+//标记有歧义的字段名,已经映射的更深层的同名字段也需要移除
+func (m *structMeta) markAmbiguous(column string, depth int, writable bool) {
+	if exists, ok := m.columns[column]; ok {
+		if exists.depth < depth {
+			return
+		}
+		m.remove(exists)
+	}
+
+	a, ok := m.ambiguous[column]
+	switch {
+	case !ok || depth < a.depth:
+		m.ambiguous[column] = ambiguity{depth: depth, writable: writable}
+	case depth == a.depth && writable:
+		a.writable = true
+		m.ambiguous[column] = a
+	}
+}
+
+//插入和更新时是否需要写入
+func (f *fieldMeta) writable() bool {
+	return !f.auto && !f.readonly
+}
+
+func (m *structMeta) remove(f *fieldMeta) {
+	delete(m.columns, f.column)
+	for j, field := range m.fields {
+		if field == f {
+			m.fields = append(m.fields[:j], m.fields[j+1:]...)
+			break
+		}
+	}
+}
+
+//读取成员的值,路径上有nil的结构体指针时返回false
+func (f *fieldMeta) value(st reflect.Value) (reflect.Value, bool) {
+	v := st
+	for _, i := range f.index {
+		if v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(i)
+	}
+
+	return v, true
+}
+
+//根据索引路径获取结构体成员,路径上为nil的结构体指针会先初始化
+func fieldByPath(v reflect.Value, path []int) reflect.Value {
+	for _, i := range path {
+		if v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(i)
+	}
+
+	return v
+}
+
+//json属性的字段读取时先保存原始数据,再反序列化到成员中
+type jsonScanner struct {
+	dest reflect.Value
+	src  interface{} //数据库返回的原始值
+}
+
+func (s *jsonScanner) Scan(src interface{}) error {
+	s.src = cloneBytes(src)
+
+	var data []byte
+
+	switch v := src.(type) {
+	case nil:
+		s.dest.Set(reflect.Zero(s.dest.Type()))
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("cannot unmarshal %T into %v", src, s.dest.Type())
+	}
+
+	return json.Unmarshal(data, s.dest.Addr().Interface())
+}
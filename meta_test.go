@@ -0,0 +1,154 @@
+package kdb
+
+import (
+	"database/sql/driver"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type benchBase struct {
+	CreatedAt time.Time `db:"created_at"`
+	UpdatedAt time.Time `db:"updated_at"`
+}
+
+type benchUser struct {
+	benchBase
+	Id      int64   `db:"id;auto"`
+	Name    string  `db:"name"`
+	Email   string  `db:"email;omitempty"`
+	Status  int     `db:"status;default:1"`
+	Score   float64 `db:"score"`
+	Remark  *string `db:"remark"`
+	Profile *testProfile
+}
+
+type testAudit struct {
+	UpdatedAt string `db:"updated_at"`
+}
+
+type testEdit struct {
+	UpdatedAt string `db:"updated_at"`
+}
+
+type testPost struct {
+	testAudit
+	testEdit
+	Name string `db:"name"`
+}
+
+func TestAmbiguousColumnWrite(t *testing.T) {
+	setupTestDB()
+
+	meta, err := getStructMeta(reflect.TypeOf(testPost{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := meta.columns["updated_at"]; ok {
+		t.Fatal("ambiguous column should not be mapped")
+	}
+
+	post := testPost{testAudit{"a"}, testEdit{"b"}, "name"}
+	if _, _, err := Table("post").getInsertMap(post, true); err == nil {
+		t.Fatal("insert with an ambiguous column should fail")
+	}
+
+	columns, _, err := Table("post").Except("updated_at").getInsertMap(post, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(columns) != 1 || columns[0] != "name" {
+		t.Fatalf("got columns %v, want [name]", columns)
+	}
+}
+
+var benchUserType = reflect.TypeOf(benchUser{})
+
+func clearStructMeta() {
+	structMetaCache.Delete(structMetaKey{typ: benchUserType, tag: kdb.structTag})
+}
+
+func setBenchRows() {
+	now := time.Now()
+	rows := make([][]driver.Value, 100)
+	for i := range rows {
+		rows[i] = []driver.Value{int64(i), "name", "a@b.c", int64(1), 1.5, nil, int64(20), now, now}
+	}
+	setTestRows([]string{"id", "name", "email", "status", "score", "remark", "age", "created_at", "updated_at"}, rows...)
+}
+
+func BenchmarkGetStructMetaCold(b *testing.B) {
+	setupTestDB()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		clearStructMeta()
+		if _, err := getStructMeta(benchUserType); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGetStructMetaCached(b *testing.B) {
+	setupTestDB()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := getStructMeta(benchUserType); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchmarkToStruct(b *testing.B, cold bool) {
+	setupTestDB()
+	setBenchRows()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		if cold {
+			clearStructMeta()
+		}
+
+		var users []benchUser
+		if err := Table("user").Get().ToStruct(&users); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkToStructCold(b *testing.B) {
+	benchmarkToStruct(b, true)
+}
+
+func BenchmarkToStructCached(b *testing.B) {
+	benchmarkToStruct(b, false)
+}
+
+func benchmarkExtractInsertMap(b *testing.B, cold bool) {
+	setupTestDB()
+	remark := "remark"
+	u := benchUser{Name: "name", Email: "a@b.c", Remark: &remark, Profile: &testProfile{Age: 20}}
+	builder := Table("user")
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		if cold {
+			clearStructMeta()
+		}
+
+		if _, _, err := builder.extractInsertMap(u, true, true); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkExtractInsertMapCold(b *testing.B) {
+	benchmarkExtractInsertMap(b, true)
+}
+
+func BenchmarkExtractInsertMapCached(b *testing.B) {
+	benchmarkExtractInsertMap(b, false)
+}
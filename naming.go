@@ -0,0 +1,152 @@
+/**
+ * @Author : nopsky
+ * @Email : cnnopsky@gmail.com
+ * @Date : 2026/10/19 20:15
+ */
+package kdb
+
+import (
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+//命名规则,把没有tag的结构体成员名转换成字段名,把结构体的类型名转换成表名
+type NamingStrategy interface {
+	ColumnName(fieldName string) string
+	TableName(typeName string) string
+}
+
+//蛇形命名,默认的命名规则,UserName对应user_name,表名使用复数形式,例如UserProfile对应user_profiles
+type SnakeNaming struct{}
+
+func (SnakeNaming) ColumnName(fieldName string) string {
+	return snakeCase(fieldName)
+}
+
+func (SnakeNaming) TableName(typeName string) string {
+	return pluralize(snakeCase(typeName))
+}
+
+//驼峰命名,UserName对应userName,表名使用复数形式,例如UserProfile对应userProfiles
+type CamelNaming struct{}
+
+func (CamelNaming) ColumnName(fieldName string) string {
+	return camelCase(fieldName)
+}
+
+func (CamelNaming) TableName(typeName string) string {
+	return pluralize(camelCase(typeName))
+}
+
+//只映射带有tag的成员,没有tag的成员会被忽略,表名使用蛇形命名
+type TagOnlyNaming struct {
+	SnakeNaming
+}
+
+func (TagOnlyNaming) ColumnName(fieldName string) string {
+	return ""
+}
+
+//自定义命名规则,Column或Table为nil时使用蛇形命名,Column返回空字符串时该成员不做映射
+type NamingFunc struct {
+	Column func(fieldName string) string
+	Table  func(typeName string) string
+}
+
+func (n NamingFunc) ColumnName(fieldName string) string {
+	if n.Column == nil {
+		return SnakeNaming{}.ColumnName(fieldName)
+	}
+	return n.Column(fieldName)
+}
+
+func (n NamingFunc) TableName(typeName string) string {
+	if n.Table == nil {
+		return SnakeNaming{}.TableName(typeName)
+	}
+	return n.Table(typeName)
+}
+
+//结构体实现了这个接口时,Model使用TableName的返回值作为表名
+type tabler interface {
+	TableName() string
+}
+
+//获取结构体对应的表名,支持结构体、结构体指针以及结构体slice的指针,不包含表前缀
+func modelTableName(model interface{}) string {
+	if t, ok := model.(tabler); ok {
+		return t.TableName()
+	}
+
+	typ := reflect.TypeOf(model)
+	for typ.Kind() == reflect.Ptr || typ.Kind() == reflect.Slice || typ.Kind() == reflect.Array {
+		typ = typ.Elem()
+	}
+
+	//TableName定义在指针上时,或者传入的是slice时,通过新建的值获取
+	if t, ok := reflect.New(typ).Interface().(tabler); ok {
+		return t.TableName()
+	}
+
+	return kdb.naming.TableName(typ.Name())
+}
+
+//把驼峰命名转换成蛇形命名,例如UserID转换成user_id
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var buf strings.Builder
+
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			//前一个是小写,或者后一个是小写(处理ID、HTTPServer这样的缩写)时需要分隔
+			if i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1]))) {
+				buf.WriteByte('_')
+			}
+			buf.WriteRune(unicode.ToLower(r))
+			continue
+		}
+		buf.WriteRune(r)
+	}
+
+	return buf.String()
+}
+
+//首字母(以及开头的缩写)转换成小写,例如UserName转换成userName,ID转换成id
+func camelCase(name string) string {
+	runes := []rune(name)
+
+	for i := range runes {
+		if !unicode.IsUpper(runes[i]) {
+			break
+		}
+
+		//缩写后面紧跟小写字母时,最后一个大写字母属于下一个单词
+		if i > 0 && i+1 < len(runes) && unicode.IsLower(runes[i+1]) {
+			break
+		}
+
+		runes[i] = unicode.ToLower(runes[i])
+	}
+
+	return string(runes)
+}
+
+//转换成复数形式,只处理常见的英文规则
+func pluralize(name string) string {
+	if name == "" {
+		return name
+	}
+
+	lower := strings.ToLower(name)
+
+	switch {
+	case strings.HasSuffix(lower, "s"), strings.HasSuffix(lower, "x"), strings.HasSuffix(lower, "z"),
+		strings.HasSuffix(lower, "ch"), strings.HasSuffix(lower, "sh"):
+		return name + "es"
+	case strings.HasSuffix(lower, "y") && len(lower) > 1 && !strings.ContainsRune("aeiou", rune(lower[len(lower)-2])):
+		return name[:len(name)-1] + "ies"
+	default:
+		return name + "s"
+	}
+}
@@ -0,0 +1,408 @@
+/**
+ * @Author : nopsky
+ * @Email : cnnopsky@gmail.com
+ * @Date : 2026/10/19 10:12
+ */
+package kdb
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultPerPage = 15
+
+//分页结果
+type Paginator struct {
+	Items       interface{} //当前页的数据,即传入的dest
+	Total       int64       //总记录数
+	PerPage     int         //每页数量
+	CurrentPage int         //当前页码
+	LastPage    int         //最后一页的页码
+}
+
+//简单分页结果,不统计总数
+type SimplePaginator struct {
+	Items       interface{}
+	PerPage     int
+	CurrentPage int
+	HasMore     bool //是否还有下一页
+}
+
+func (p *Paginator) HasMorePages() bool {
+	return p.CurrentPage < p.LastPage
+}
+
+//分页查询,dest支持的类型与Rows.ToStruct一致
+func (b *Builder) Paginate(page, perPage int, dest interface{}) (*Paginator, error) {
+	page, perPage = normalizePage(page, perPage)
+
+	//dest是slice的指针时先清空,避免重复使用时保留上一页的数据
+	if destVal := reflect.ValueOf(dest); destVal.Kind() == reflect.Ptr && destVal.Elem().Kind() == reflect.Slice {
+		destVal.Elem().SetLen(0)
+	}
+
+	counter := b.Clone()
+	counter.offsetFlag = false
+	counter.limitFlag = false
+
+	total, err := counter.countTotal()
+	if err != nil {
+		return nil, err
+	}
+
+	p := new(Paginator)
+	p.Items = dest
+	p.Total = total
+	p.PerPage = perPage
+	p.CurrentPage = page
+	p.LastPage = int((total + int64(perPage) - 1) / int64(perPage))
+	if p.LastPage < 1 {
+		p.LastPage = 1
+	}
+
+	if total == 0 {
+		return p, nil
+	}
+
+	err = b.Clone().Offset((page - 1) * perPage).Limit(perPage).Get().ToStruct(dest)
+	if err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+//统计分页的总数,分组或去重的查询需要通过子查询统计,否则count(*)返回的是第一组的数量
+func (b *Builder) countTotal() (int64, error) {
+	if len(b.groups) == 0 && !b.distinct {
+		return b.Count()
+	}
+
+	q := b.Clone()
+	q.orders = nil
+	delete(q.bindings, "order")
+
+	sql := fmt.Sprintf("select count(*) as %s from (%s) as %s", q.grammar.wrapValue("aggregate"), q.toSQL(), q.grammar.wrapValue("aggregate_table"))
+
+	result, err := q.selectSQL(sql, q.getBindings()).ToMap()
+	if err != nil {
+		return 0, err
+	}
+
+	if len(result) == 0 || result[0]["aggregate"] == "" {
+		return 0, nil
+	}
+
+	return strconv.ParseInt(result[0]["aggregate"], 10, 64)
+}
+
+//简单分页查询,多取一条数据来判断是否有下一页,dest必须是slice的指针
+func (b *Builder) SimplePaginate(page, perPage int, dest interface{}) (*SimplePaginator, error) {
+	page, perPage = normalizePage(page, perPage)
+
+	destVal := reflect.ValueOf(dest)
+	if destVal.Kind() != reflect.Ptr || destVal.Elem().Kind() != reflect.Slice {
+		return nil, fmt.Errorf("the variable type is %v, not a slice pointer", destVal.Kind())
+	}
+
+	destVal.Elem().SetLen(0)
+
+	err := b.Clone().Offset((page - 1) * perPage).Limit(perPage + 1).Get().ToStruct(dest)
+	if err != nil {
+		return nil, err
+	}
+
+	p := new(SimplePaginator)
+	p.Items = dest
+	p.PerPage = perPage
+	p.CurrentPage = page
+
+	items := destVal.Elem()
+	if items.Len() > perPage {
+		p.HasMore = true
+		items.Set(items.Slice(0, perPage))
+	}
+
+	return p, nil
+}
+
+//游标分页结果
+type CursorPaginator struct {
+	Items      interface{}
+	PerPage    int
+	NextCursor string //下一页的游标,为空表示没有下一页
+	PrevCursor string //上一页的游标,为空表示没有上一页
+}
+
+//游标中保存的内容
+type cursor struct {
+	Values     []cursorValue `json:"v"`
+	PointsPrev bool          `json:"p,omitempty"`
+}
+
+//time.Time单独保存,保证解码后仍然以时间类型绑定到查询中
+type cursorValue struct {
+	Time  *time.Time  `json:"t,omitempty"`
+	Value interface{} `json:"v,omitempty"`
+}
+
+//基于游标的分页,使用OrderBy中的字段生成(a, b) > (?, ?)的条件,避免大偏移量带来的性能问题
+//cursor为空时查询第一页,dest必须是slice的指针
+func (b *Builder) CursorPaginate(perPage int, cursorToken string, dest interface{}) (*CursorPaginator, error) {
+	_, perPage = normalizePage(1, perPage)
+
+	destVal := reflect.ValueOf(dest)
+	if destVal.Kind() != reflect.Ptr || destVal.Elem().Kind() != reflect.Slice {
+		return nil, fmt.Errorf("the variable type is %v, not a slice pointer", destVal.Kind())
+	}
+
+	if len(b.orders) == 0 {
+		return nil, errors.New("you must specify an order by clause when using cursor paginate")
+	}
+
+	destVal.Elem().SetLen(0)
+
+	var cur *cursor
+	if cursorToken != "" {
+		var err error
+		cur, err = decodeCursor(cursorToken)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(cur.Values) != len(b.orders) {
+			return nil, errors.New("the cursor does not match the order by clause")
+		}
+	}
+
+	q := b.Clone()
+
+	//向前翻页时反转排序,查询后再把结果反转回来
+	if cur != nil && cur.PointsPrev {
+		for i, o := range q.orders {
+			q.orders[i].direction = reverseDirection(o.direction)
+		}
+	}
+
+	if cur != nil {
+		sql, bindings := q.compileCursorWhere(cur.bindings())
+		q.groupWheres().WhereRaw(sql, bindings...)
+	}
+
+	aliases := make([]string, len(q.orders))
+	for i, o := range q.orders {
+		aliases[i] = o.column
+		if j := strings.LastIndex(o.column, "."); j >= 0 {
+			aliases[i] = o.column[j+1:]
+		}
+	}
+
+	rows := q.Limit(perPage + 1).Get()
+	rows.remember(aliases...)
+
+	if err := rows.ToStruct(dest); err != nil {
+		return nil, err
+	}
+
+	//排序字段必须在查询结果中,否则无法生成下一页的游标
+	for _, alias := range aliases {
+		if !inStrings(rows.fields, alias) {
+			return nil, fmt.Errorf("the cursor column `%s` is not found in the result", alias)
+		}
+	}
+
+	history := rows.history
+	items := destVal.Elem()
+	if items.Len() != len(history) {
+		return nil, errors.New("the number of items does not match the number of rows")
+	}
+
+	hasMore := items.Len() > perPage
+	if hasMore {
+		items.Set(items.Slice(0, perPage))
+		history = history[:perPage]
+	}
+
+	pointsPrev := cur != nil && cur.PointsPrev
+	if pointsPrev {
+		reverseSlice(items)
+		for i, j := 0, len(history)-1; i < j; i, j = i+1, j-1 {
+			history[i], history[j] = history[j], history[i]
+		}
+	}
+
+	p := new(CursorPaginator)
+	p.Items = dest
+	p.PerPage = perPage
+
+	if len(history) == 0 {
+		return p, nil
+	}
+
+	var err error
+
+	if (!pointsPrev && hasMore) || pointsPrev {
+		p.NextCursor, err = encodeCursor(history[len(history)-1], false)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if (!pointsPrev && cur != nil) || (pointsPrev && hasMore) {
+		p.PrevCursor, err = encodeCursor(history[0], true)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return p, nil
+}
+
+//生成游标条件,排序方向一致时使用(a, b) > (?, ?),否则展开成(a > ? or (a = ? and b < ?))
+func (b *Builder) compileCursorWhere(values []interface{}) (string, []interface{}) {
+	columns := make([]string, len(b.orders))
+	operators := make([]string, len(b.orders))
+	mixed := false
+
+	for i, o := range b.orders {
+		columns[i] = b.grammar.wrapColumn(o.column)
+		operators[i] = ">"
+		if strings.ToLower(o.direction) == "desc" {
+			operators[i] = "<"
+		}
+
+		if operators[i] != operators[0] {
+			mixed = true
+		}
+	}
+
+	if len(columns) == 1 {
+		return fmt.Sprintf("%s %s ?", columns[0], operators[0]), values
+	}
+
+	if !mixed {
+		placeHolder := strings.Repeat("?, ", len(columns))
+		return fmt.Sprintf("(%s) %s (%s)", strings.Join(columns, ", "), operators[0], placeHolder[:len(placeHolder)-2]), values
+	}
+
+	ors := make([]string, len(columns))
+	bindings := make([]interface{}, 0)
+
+	for i := range columns {
+		ands := make([]string, 0, i+1)
+		for j := 0; j < i; j++ {
+			ands = append(ands, fmt.Sprintf("%s = ?", columns[j]))
+			bindings = append(bindings, values[j])
+		}
+		ands = append(ands, fmt.Sprintf("%s %s ?", columns[i], operators[i]))
+		bindings = append(bindings, values[i])
+		ors[i] = fmt.Sprintf("(%s)", strings.Join(ands, " and "))
+	}
+
+	return fmt.Sprintf("(%s)", strings.Join(ors, " or ")), bindings
+}
+
+func (c *cursor) bindings() []interface{} {
+	bindings := make([]interface{}, len(c.Values))
+	for i, v := range c.Values {
+		if v.Time != nil {
+			bindings[i] = *v.Time
+			continue
+		}
+
+		//json.Number优先还原为整数,避免float64丢失精度
+		if n, ok := v.Value.(json.Number); ok {
+			if i64, err := n.Int64(); err == nil {
+				bindings[i] = i64
+			} else if f64, err := n.Float64(); err == nil {
+				bindings[i] = f64
+			} else {
+				bindings[i] = n.String()
+			}
+			continue
+		}
+
+		bindings[i] = v.Value
+	}
+	return bindings
+}
+
+func encodeCursor(values []interface{}, pointsPrev bool) (string, error) {
+	c := cursor{PointsPrev: pointsPrev}
+
+	for _, v := range values {
+		if valuer, ok := v.(driver.Valuer); ok {
+			var err error
+			if v, err = valuer.Value(); err != nil {
+				return "", err
+			}
+		}
+
+		switch val := v.(type) {
+		case time.Time:
+			c.Values = append(c.Values, cursorValue{Time: &val})
+		case []byte:
+			c.Values = append(c.Values, cursorValue{Value: string(val)})
+		default:
+			c.Values = append(c.Values, cursorValue{Value: val})
+		}
+	}
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeCursor(token string) (*cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+
+	c := new(cursor)
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(c); err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+
+	return c, nil
+}
+
+func reverseDirection(direction string) string {
+	if strings.ToLower(direction) == "desc" {
+		return "asc"
+	}
+	return "desc"
+}
+
+func reverseSlice(items reflect.Value) {
+	swap := reflect.Swapper(items.Interface())
+	for i, j := 0, items.Len()-1; i < j; i, j = i+1, j-1 {
+		swap(i, j)
+	}
+}
+
+func normalizePage(page, perPage int) (int, int) {
+	if page < 1 {
+		page = 1
+	}
+
+	if perPage < 1 {
+		perPage = defaultPerPage
+	}
+
+	return page, perPage
+}
@@ -0,0 +1,155 @@
+package kdb
+
+import (
+	"database/sql/driver"
+	"reflect"
+	"testing"
+)
+
+func TestPaginateResetsDest(t *testing.T) {
+	setupTestDB()
+
+	users := []testUser{{Id: 9}, {Id: 8}}
+
+	setTestRows([]string{"aggregate"}, []driver.Value{int64(0)})
+	if _, err := Table("user").Paginate(2, 2, &users); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(users) != 0 {
+		t.Fatalf("got %d users, want 0", len(users))
+	}
+}
+
+type testLevel struct {
+	n int64
+}
+
+type testMember struct {
+	Id    int64     `db:"id"`
+	Level testLevel `db:"level"`
+	Tags  []string  `db:"tags;json"`
+}
+
+func TestCursorPaginateConvertedColumns(t *testing.T) {
+	setupTestDB()
+	RegisterConverter(testLevel{}, Converter{
+		FromDB: func(src interface{}, dest interface{}) error {
+			dest.(*testLevel).n = src.(int64)
+			return nil
+		},
+	})
+
+	setTestRows([]string{"id", "level", "tags"},
+		[]driver.Value{int64(1), int64(3), []byte(`["a"]`)},
+		[]driver.Value{int64(2), int64(5), []byte(`["b"]`)},
+	)
+
+	var members []testMember
+	p, err := Table("member").OrderBy("level").OrderBy("tags").CursorPaginate(1, "", &members)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cur, err := decodeCursor(p.NextCursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []interface{}{int64(3), `["a"]`}
+	if got := cur.bindings(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got cursor values %#v, want %#v", got, want)
+	}
+}
+
+func TestCompileCursorWhere(t *testing.T) {
+	setupTestDB()
+
+	cases := []struct {
+		driver   string
+		orders   [][2]string
+		sql      string
+		bindings []interface{}
+	}{
+		{"mysql", [][2]string{{"id", "asc"}}, "`id` > ?", []interface{}{1}},
+		{"mysql", [][2]string{{"id", "desc"}}, "`id` < ?", []interface{}{1}},
+		{"mysql", [][2]string{{"name", "asc"}, {"id", "asc"}}, "(`name`, `id`) > (?, ?)", []interface{}{1, 2}},
+		{"postgres", [][2]string{{"name", "desc"}, {"id", "desc"}}, `("name", "id") < (?, ?)`, []interface{}{1, 2}},
+		{"mysql", [][2]string{{"name", "asc"}, {"id", "desc"}}, "((`name` > ?) or (`name` = ? and `id` < ?))", []interface{}{1, 1, 2}},
+		{
+			"postgres", [][2]string{{"a", "desc"}, {"b", "asc"}, {"c", "desc"}},
+			`(("a" < ?) or ("a" = ? and "b" > ?) or ("a" = ? and "b" = ? and "c" < ?))`,
+			[]interface{}{1, 1, 2, 1, 2, 3},
+		},
+	}
+
+	for _, c := range cases {
+		b := newBuilder(newConnection(), &Grammar{driver: c.driver}).Table("user")
+		values := make([]interface{}, len(c.orders))
+		for i, o := range c.orders {
+			b.OrderBy(o[0], o[1])
+			values[i] = i + 1
+		}
+
+		sql, bindings := b.compileCursorWhere(values)
+		if sql != c.sql || !reflect.DeepEqual(bindings, c.bindings) {
+			t.Errorf("%s %v: got %s %v, want %s %v", c.driver, c.orders, sql, bindings, c.sql, c.bindings)
+		}
+	}
+}
+
+func TestCursorPaginateRoundTrip(t *testing.T) {
+	setupTestDB()
+	setTestRows([]string{"id", "name"},
+		[]driver.Value{int64(1), "a"},
+		[]driver.Value{int64(2), "b"},
+	)
+
+	q := Table("user").Where("age", 1).OrWhere("age", 2).OrderBy("name").OrderBy("id", "desc")
+
+	steps := []struct {
+		sql      string
+		bindings []interface{}
+	}{
+		{
+			"select * from user where `age` = ? or `age` = ? order by `name` asc, `id` desc limit 2",
+			[]interface{}{int64(1), int64(2)},
+		},
+		{
+			"select * from user where (`age` = ? or `age` = ?) and ((`name` > ?) or (`name` = ? and `id` < ?)) order by `name` asc, `id` desc limit 2",
+			[]interface{}{int64(1), int64(2), "a", "a", int64(1)},
+		},
+		{
+			"select * from user where (`age` = ? or `age` = ?) and ((`name` < ?) or (`name` = ? and `id` > ?)) order by `name` desc, `id` asc limit 2",
+			[]interface{}{int64(1), int64(2), "a", "a", int64(1)},
+		},
+	}
+
+	var token string
+	for i, step := range steps {
+		var users []testUser
+		p, err := q.CursorPaginate(1, token, &users)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sql, bindings := lastTestQuery()
+		if sql != step.sql || !reflect.DeepEqual(bindings, step.bindings) {
+			t.Fatalf("step %d: got %s %v, want %s %v", i, sql, bindings, step.sql, step.bindings)
+		}
+
+		if len(users) != 1 || *users[0].Name != "a" {
+			t.Fatalf("step %d: got users %v", i, users)
+		}
+
+		//第一页向后翻,第二页通过上一页的游标向前翻
+		token = p.NextCursor
+		if i == 1 {
+			token = p.PrevCursor
+		}
+
+		if token == "" {
+			t.Fatalf("step %d: missing cursor", i)
+		}
+	}
+}
@@ -9,8 +9,30 @@ import (
 	"database/sql"
 	"fmt"
 	"reflect"
+	"strings"
+	"sync"
 )
 
+//scan时使用的缓冲区,在Rows关闭后放回池中复用
+var scanBufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(scanBuffer)
+	},
+}
+
+type scanBuffer struct {
+	refs  []interface{} //传给Scan的参数
+	sinks []interface{} //结构体中没有对应成员的字段,读取后丢弃
+}
+
+//查询字段到结构体成员的映射,同一个结果集中只需要计算一次
+type scanPlan struct {
+	typ    reflect.Type
+	fields []*fieldMeta //每个查询字段对应的成员,nil表示结构体中没有对应的成员
+
+	unmatched []string //结构体中没有对应成员的查询字段
+	missing   []string //查询结果中没有对应字段的成员
+}
 
 type Row struct {
 	rs *Rows
@@ -23,6 +45,11 @@ func (r *Row) ToArray() (result []string, err error) {
 		r.lastError = err
 		return nil, err
 	}
+
+	if len(items) == 0 {
+		return nil, sql.ErrNoRows
+	}
+
 	return items[0], nil
 }
 
@@ -32,67 +59,399 @@ func (r *Row) ToMap() (result map[string]string, err error) {
 		r.lastError = err
 		return nil, err
 	}
+
+	if len(items) == 0 {
+		return nil, sql.ErrNoRows
+	}
+
 	return items[0], nil
 }
 
-func (r *Row) ToStruct(st interface{}) error{
-	//获取变量的类型
-	stType := reflect.TypeOf(st)
-
-	stVal := reflect.ValueOf(st)
+func (r *Row) ToMapTyped() (result map[string]interface{}, err error) {
+	items, err := r.rs.ToMapTyped()
+	if err != nil {
+		r.lastError = err
+		return nil, err
+	}
 
-	if stType.Kind() != reflect.Ptr {
-		return fmt.Errorf("the variable type is %v, not a pointer", stType.Kind())
+	if len(items) == 0 {
+		return nil, sql.ErrNoRows
 	}
 
-	stTypeInd := stType.Elem()
+	return items[0], nil
+}
 
-	if r.rs.rs == nil {
-		return r.lastError
+func (r *Row) ToSliceTyped() (result []interface{}, err error) {
+	items, err := r.rs.ToSliceTyped()
+	if err != nil {
+		r.lastError = err
+		return nil, err
 	}
 
-	defer r.rs.rs.Close()
+	if len(items) == 0 {
+		return nil, sql.ErrNoRows
+	}
 
-	v := reflect.New(stTypeInd)
+	return items[0], nil
+}
 
-	tagList, err := extractTagInfo(v)
+func (r *Row) ToMapNullable() (result map[string]*string, err error) {
+	items, err := r.rs.ToMapNullable()
 	if err != nil {
-		return err
+		r.lastError = err
+		return nil, err
 	}
 
-	fields, err := r.rs.rs.Columns()
+	if len(items) == 0 {
+		return nil, sql.ErrNoRows
+	}
 
-	if err != nil {
-		r.rs.lastError = err
+	return items[0], nil
+}
+
+//开启严格模式,与Rows.Strict相同
+func (r *Row) Strict(strict ...bool) *Row {
+	r.rs.Strict(strict...)
+	return r
+}
+
+//读取第一行数据,st支持结构体指针和单字段的基础类型指针,没有数据时返回sql.ErrNoRows
+func (r *Row) ToStruct(st interface{}) error {
+	if err := r.rs.ToStruct(st); err != nil {
+		r.lastError = err
 		return err
 	}
+	return nil
+}
 
-	refs := make([]interface{}, len(fields))
+type Rows struct {
+	rs        *sql.Rows
+	lastError error
+	fields    []string
+	types     []*sql.ColumnType
+	peeked    bool            //是否已经预读了一行
+	scanned   int             //已经读取的行数
+	remembers []string        //需要记录每一行值的字段
+	history   [][]interface{} //remembers中的字段在每一行的值
+	plan      *scanPlan
+	buf       *scanBuffer
+	strict    bool //严格模式,查询字段和结构体成员不能一一对应时返回错误
+}
+
+//移动到下一行,配合Scan进行逐行读取
+func (r *Rows) Next() bool {
+	if r.rs == nil {
+		return false
+	}
+
+	if r.peeked {
+		r.peeked = false
+		return true
+	}
+
+	if r.rs.Next() {
+		r.scanned++
+		return true
+	}
+
+	return false
+}
+
+//预读一行,用于在不消费数据的情况下判断结果是否为空
+func (r *Rows) prefetch() bool {
+	if r.peeked {
+		return true
+	}
+
+	if !r.Next() {
+		return false
+	}
+
+	r.peeked = true
+	return true
+}
+
+//将当前行的数据扫描到dst中,dst可以是结构体指针,也可以是单字段的基础类型指针
+func (r *Rows) Scan(dst interface{}) error {
+	stVal := reflect.ValueOf(dst)
+
+	if stVal.Kind() != reflect.Ptr || stVal.IsNil() {
+		return fmt.Errorf("the variable type is %v, not a pointer", stVal.Kind())
+	}
+
+	if r.rs == nil {
+		return r.lastError
+	}
+
+	_, err := r.scanValue(stVal, "")
+
+	return err
+}
 
+func (r *Rows) Err() error {
+	if r.lastError != nil {
+		return r.lastError
+	}
+
+	if r.rs == nil {
+		return nil
+	}
+
+	return r.rs.Err()
+}
+
+func (r *Rows) Close() error {
+	if r.rs == nil {
+		return nil
+	}
+
+	r.releaseBuffer()
+
+	return r.rs.Close()
+}
+
+//获取scan使用的缓冲区,长度与查询的字段数一致
+func (r *Rows) buffer(num int) *scanBuffer {
+	if r.buf == nil {
+		r.buf = scanBufferPool.Get().(*scanBuffer)
+	}
+
+	buf := r.buf
+	if cap(buf.refs) < num {
+		buf.refs = make([]interface{}, num)
+	}
+	buf.refs = buf.refs[:num]
+
+	for len(buf.sinks) < num {
+		buf.sinks = append(buf.sinks, new(interface{}))
+	}
+
+	return buf
+}
+
+func (r *Rows) releaseBuffer() {
+	if r.buf == nil {
+		return
+	}
+
+	//不再引用调用方的结构体,避免放回池中后无法回收
+	for i := range r.buf.refs {
+		r.buf.refs[i] = nil
+	}
+	for _, sink := range r.buf.sinks {
+		*sink.(*interface{}) = nil
+	}
+
+	scanBufferPool.Put(r.buf)
+	r.buf = nil
+}
+
+//严格模式下检查查询字段和结构体成员是否一一对应,作为map的key的字段可以没有对应的成员
+func (p *scanPlan) check(keyColumn string) error {
+	unmatched := make([]string, 0, len(p.unmatched))
+	for _, column := range p.unmatched {
+		if column != keyColumn {
+			unmatched = append(unmatched, column)
+		}
+	}
+
+	if len(unmatched) == 0 && len(p.missing) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("strict scan into %v failed, unmatched columns: [%s], unpopulated fields: [%s]",
+		p.typ, strings.Join(unmatched, ", "), strings.Join(p.missing, ", "))
+}
+
+//开启严格模式,查询结果中有结构体没有映射的字段,或者结构体中有成员没有被赋值时返回错误
+//strict为false时关闭,用于覆盖KConfig中的StrictScan
+func (r *Rows) Strict(strict ...bool) *Rows {
+	r.strict = true
+	if len(strict) > 0 {
+		r.strict = strict[0]
+	}
+	return r
+}
+
+//获取查询字段到结构体成员的映射,结果集中的字段不会变化,所以按照类型缓存在Rows中
+func (r *Rows) planFor(t reflect.Type, fields []string) (*scanPlan, error) {
+	if r.plan != nil && r.plan.typ == t {
+		return r.plan, nil
+	}
+
+	meta, err := getStructMeta(t)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &scanPlan{typ: t, fields: make([]*fieldMeta, len(fields))}
+	populated := make(map[string]bool, len(fields))
 	for i, field := range fields {
-		if f, ok := tagList[field]; ok {
-			refs[i] = f.Addr().Interface()
-		} else {
-			refs[i] = new(interface{})
+		f, ok := meta.columns[field]
+		if !ok {
+			f, ok = meta.aliases[field]
 		}
+
+		if !ok {
+			plan.unmatched = append(plan.unmatched, field)
+			continue
+		}
+
+		plan.fields[i] = f
+		populated[fmt.Sprint(f.index)] = true
+	}
+
+	for _, f := range meta.fields {
+		if !populated[fmt.Sprint(f.index)] {
+			plan.missing = append(plan.missing, f.column)
+		}
+	}
+
+	r.plan = plan
+
+	return plan, nil
+}
+
+func (r *Rows) columns() ([]string, error) {
+	if r.fields != nil {
+		return r.fields, nil
+	}
+
+	fields, err := r.rs.Columns()
+	if err != nil {
+		r.lastError = err
+		return nil, err
+	}
+
+	r.fields = fields
+
+	return fields, nil
+}
+
+func (r *Rows) columnTypes() ([]*sql.ColumnType, error) {
+	if r.types != nil {
+		return r.types, nil
+	}
+
+	types, err := r.rs.ColumnTypes()
+	if err != nil {
+		r.lastError = err
+		return nil, err
+	}
+
+	r.types = types
+
+	return types, nil
+}
+
+//读取当前行,并根据字段类型把驱动返回的值转换成对应的go类型
+func (r *Rows) scanTyped() ([]interface{}, error) {
+	types, err := r.columnTypes()
+	if err != nil {
+		return nil, err
 	}
 
-	if !r.rs.rs.Next() {
-		return sql.ErrNoRows
+	refs := make([]interface{}, len(types))
+	for i := range refs {
+		refs[i] = new(interface{})
+	}
+
+	if err := r.scan(refs...); err != nil {
+		return nil, err
+	}
+
+	result := make([]interface{}, len(types))
+	for i, ct := range types {
+		val, err := normalizeValue(*refs[i].(*interface{}), ct.DatabaseTypeName())
+		if err != nil {
+			return nil, err
+		}
+		result[i] = val
 	}
 
-	if err := r.rs.rs.Scan(refs...); err != nil {
+	return result, nil
+}
+
+//记录指定字段在每一行的值,用于ChunkById和游标分页生成下一次查询的条件
+func (r *Rows) remember(columns ...string) {
+	r.remembers = columns
+	r.history = nil
+}
+
+func (r *Rows) scan(refs ...interface{}) error {
+	if err := r.rs.Scan(refs...); err != nil {
+		r.lastError = err
 		return err
 	}
 
-	stVal.Elem().Set(v.Elem())
+	if len(r.remembers) == 0 {
+		return nil
+	}
+
+	vals := make([]interface{}, len(r.remembers))
+	for i, column := range r.remembers {
+		for j, field := range r.fields {
+			if field == column {
+				vals[i] = scannedValue(refs[j])
+				break
+			}
+		}
+	}
+	r.history = append(r.history, vals)
 
 	return nil
 }
 
-type Rows struct {
-	rs        *sql.Rows
-	lastError error
+//Scan之后参数中的值,json和注册了转换的字段使用数据库返回的原始值
+func scannedValue(ref interface{}) interface{} {
+	switch s := ref.(type) {
+	case *jsonScanner:
+		return s.src
+	case *converterScanner:
+		return s.src
+	}
+
+	return reflect.Indirect(reflect.ValueOf(ref)).Interface()
+}
+
+//驱动返回的[]byte在下一次Scan时可能被复用,需要保留时先复制一份
+func cloneBytes(src interface{}) interface{} {
+	if b, ok := src.([]byte); ok {
+		return append([]byte(nil), b...)
+	}
+	return src
+}
+
+//读取完剩余的数据并关闭,返回总共读取的行数
+func (r *Rows) drain() (int, error) {
+	if r.rs == nil {
+		return 0, r.lastError
+	}
+
+	defer r.Close()
+
+	for r.Next() {
+		//调用方没有读取的行,也需要记录remembers中字段的值
+		if len(r.remembers) == 0 {
+			continue
+		}
+
+		fields, err := r.columns()
+		if err != nil {
+			return r.scanned, err
+		}
+
+		refs := make([]interface{}, len(fields))
+		for i := range refs {
+			refs[i] = new(interface{})
+		}
+
+		if err := r.scan(refs...); err != nil {
+			return r.scanned, err
+		}
+	}
+
+	return r.scanned, r.rs.Err()
 }
 
 func (r *Rows) ToArray() (data [][]string, err error) {
@@ -104,10 +463,9 @@ func (r *Rows) ToArray() (data [][]string, err error) {
 	defer r.rs.Close()
 
 	//获取查询的字段
-	fields, err := r.rs.Columns()
+	fields, err := r.columns()
 
 	if err != nil {
-		r.lastError = err
 		return nil, err
 	}
 
@@ -122,11 +480,11 @@ func (r *Rows) ToArray() (data [][]string, err error) {
 		refs[i] = &ref
 	}
 
-	for r.rs.Next() {
+	for r.Next() {
 
 		result := make([]string, len(fields))
 
-		if err := r.rs.Scan(refs...); err != nil {
+		if err := r.scan(refs...); err != nil {
 			return nil, err
 		}
 
@@ -157,18 +515,15 @@ func (r *Rows) ToMap() (data []map[string]string, err error) {
 
 	defer r.rs.Close()
 
-	fields, err := r.rs.Columns()
+	fields, err := r.columns()
 
 	if err != nil {
-		r.lastError = err
 		return nil, err
 	}
 
 	data = make([]map[string]string, 0)
 	num := len(fields)
 
-	result := make(map[string]string)
-
 	refs := make([]interface{}, num)
 
 	for i := 0; i < num; i++ {
@@ -176,11 +531,13 @@ func (r *Rows) ToMap() (data []map[string]string, err error) {
 		refs[i] = &ref
 	}
 
-	for r.rs.Next() {
-		if err := r.rs.Scan(refs...); err != nil {
+	for r.Next() {
+		if err := r.scan(refs...); err != nil {
 			return nil, err
 		}
 
+		//每一行使用新的map,避免所有元素指向同一个map
+		result := make(map[string]string, num)
 		for i, field := range fields {
 			if val, err := toString(refs[i]); err == nil {
 				result[field] = val
@@ -195,69 +552,309 @@ func (r *Rows) ToMap() (data []map[string]string, err error) {
 	return data, nil
 }
 
-func (r *Rows) ToStruct(st interface{}) error {
-	//st->&[]user
-	//获取变量的类型,类型为指针
-	stType := reflect.TypeOf(st)
+//返回带类型的数据,整数为int64,浮点数为float64,时间为time.Time,文本为string,null为nil
+func (r *Rows) ToMapTyped() (data []map[string]interface{}, err error) {
+	if r.rs == nil {
+		return nil, r.lastError
+	}
 
-	//获取变量的值
-	stVal := reflect.ValueOf(st)
-	stValInd := reflect.Indirect(stVal)
+	defer r.rs.Close()
 
-	//1.参数必须是指针
-	if stType.Kind() != reflect.Ptr {
-		return fmt.Errorf("the variable type is %v, not a pointer", stType.Kind())
+	fields, err := r.columns()
+	if err != nil {
+		return nil, err
 	}
 
-	//指针指向的类型:slice
-	stTypeInd := stType.Elem()
-	//2.传入的类型必须是slice,slice的成员类型必须是struct
-	if stTypeInd.Kind() != reflect.Slice || stTypeInd.Elem().Kind() != reflect.Struct {
-		return fmt.Errorf("the variable type is %v, not a slice struct", stType.Elem().Kind())
+	data = make([]map[string]interface{}, 0)
+
+	for r.Next() {
+		values, err := r.scanTyped()
+		if err != nil {
+			return nil, err
+		}
+
+		result := make(map[string]interface{}, len(fields))
+		for i, field := range fields {
+			result[field] = values[i]
+		}
+
+		data = append(data, result)
 	}
 
+	return data, r.rs.Err()
+}
+
+func (r *Rows) ToSliceTyped() (data [][]interface{}, err error) {
 	if r.rs == nil {
-		return r.lastError
+		return nil, r.lastError
 	}
 
 	defer r.rs.Close()
 
-	//初始化struct
-	v := reflect.New(stTypeInd.Elem())
+	data = make([][]interface{}, 0)
+
+	for r.Next() {
+		values, err := r.scanTyped()
+		if err != nil {
+			return nil, err
+		}
+
+		data = append(data, values)
+	}
+
+	return data, r.rs.Err()
+}
+
+//与ToMap相同,但null返回nil,用于区分null和空字符串
+func (r *Rows) ToMapNullable() (data []map[string]*string, err error) {
+	if r.rs == nil {
+		return nil, r.lastError
+	}
+
+	defer r.rs.Close()
 
-	//提取结构体中的tag
-	tagList, err := extractTagInfo(v)
+	fields, err := r.columns()
 	if err != nil {
+		return nil, err
+	}
+
+	data = make([]map[string]*string, 0)
+
+	refs := make([]interface{}, len(fields))
+	for i := range refs {
+		refs[i] = new(interface{})
+	}
+
+	for r.Next() {
+		if err := r.scan(refs...); err != nil {
+			return nil, err
+		}
+
+		result := make(map[string]*string, len(fields))
+		for i, field := range fields {
+			if *refs[i].(*interface{}) == nil {
+				result[field] = nil
+				continue
+			}
+
+			val, err := toString(refs[i])
+			if err != nil {
+				return nil, err
+			}
+			result[field] = &val
+		}
+
+		data = append(data, result)
+	}
+
+	return data, r.rs.Err()
+}
+
+//根据st的类型读取数据,st必须是指针,支持以下类型:
+//*[]User、*[]*User:每一行对应一个结构体
+//*[]int64、*[]string等:查询结果只能有一个字段
+//*map[int64]User、*map[int64]*User、*map[int64]string:以keyColumn字段的值为key,默认为id
+//*User、*int64等:只读取第一行,没有数据时返回sql.ErrNoRows
+func (r *Rows) ToStruct(st interface{}, keyColumn ...string) error {
+	stVal := reflect.ValueOf(st)
+
+	//参数必须是指针
+	if stVal.Kind() != reflect.Ptr || stVal.IsNil() {
+		return fmt.Errorf("the variable type is %v, not a pointer", stVal.Kind())
+	}
+
+	if r.rs == nil {
+		return r.lastError
+	}
+
+	defer r.Close()
+
+	if _, err := r.columns(); err != nil {
 		return err
 	}
 
-	fields, err := r.rs.Columns()
+	dest := stVal.Elem()
 
-	if err != nil {
-		r.lastError = err
+	switch {
+	case dest.Kind() == reflect.Slice && dest.Type() != bytesType:
+		return r.scanSlice(dest)
+	case dest.Kind() == reflect.Map:
+		key := primaryKey
+		if len(keyColumn) > 0 {
+			key = keyColumn[0]
+		}
+		return r.scanMap(dest, key)
+	default:
+		if !r.Next() {
+			if err := r.rs.Err(); err != nil {
+				return err
+			}
+			return sql.ErrNoRows
+		}
+
+		_, err := r.scanValue(stVal, "")
 		return err
 	}
+}
 
-	refs := make([]interface{}, len(fields))
+//每一行都分配新的元素,避免多行数据共用同一块内存
+func (r *Rows) scanSlice(dest reflect.Value) error {
+	elemType := dest.Type().Elem()
+	items := dest
 
-	for i, field := range fields {
-		//如果对应的字段在结构体中有映射，则使用结构体成员变量的地址
-		if f, ok := tagList[field]; ok {
-			refs[i] = f.Addr().Interface()
+	for r.Next() {
+		var item reflect.Value
+
+		if elemType.Kind() == reflect.Ptr && !isScalarType(elemType.Elem()) {
+			//[]*User
+			ptr := reflect.New(elemType.Elem())
+			if _, err := r.scanValue(ptr, ""); err != nil {
+				return err
+			}
+			item = ptr
 		} else {
-			refs[i] = new(interface{})
+			//[]User、[]int64、[]*string
+			ptr := reflect.New(elemType)
+			if _, err := r.scanValue(ptr, ""); err != nil {
+				return err
+			}
+			item = ptr.Elem()
 		}
+
+		items = reflect.Append(items, item)
 	}
 
-	for r.rs.Next() {
-		if err := r.rs.Scan(refs...); err != nil {
+	if err := r.rs.Err(); err != nil {
+		return err
+	}
+
+	dest.Set(items)
+
+	return nil
+}
+
+func (r *Rows) scanMap(dest reflect.Value, keyColumn string) error {
+	keyType := dest.Type().Key()
+	elemType := dest.Type().Elem()
+
+	if dest.IsNil() {
+		dest.Set(reflect.MakeMap(dest.Type()))
+	}
+
+	for r.Next() {
+		var item reflect.Value
+		var key interface{}
+		var err error
+
+		if elemType.Kind() == reflect.Ptr && !isScalarType(elemType.Elem()) {
+			ptr := reflect.New(elemType.Elem())
+			if key, err = r.scanValue(ptr, keyColumn); err != nil {
+				return err
+			}
+			item = ptr
+		} else {
+			ptr := reflect.New(elemType)
+			if key, err = r.scanValue(ptr, keyColumn); err != nil {
+				return err
+			}
+			item = ptr.Elem()
+		}
+
+		k, err := convertKey(key, keyType)
+		if err != nil {
 			return err
 		}
-		stValInd = reflect.Append(stValInd, v.Elem())
+
+		dest.SetMapIndex(k, item)
 	}
 
-	stVal.Elem().Set(stValInd)
+	return r.rs.Err()
+}
 
-	return nil
+//把当前行扫描到ptr指向的值中,keyColumn不为空时返回该字段的值
+//结构体按照tag映射字段,基础类型只能对应一个字段(有keyColumn时为除keyColumn外的另一个字段)
+func (r *Rows) scanValue(ptr reflect.Value, keyColumn string) (key interface{}, err error) {
+	fields, err := r.columns()
+	if err != nil {
+		return nil, err
+	}
+
+	keyIndex := -1
+	if keyColumn != "" {
+		for i, field := range fields {
+			if field == keyColumn {
+				keyIndex = i
+				break
+			}
+		}
+
+		if keyIndex < 0 {
+			return nil, fmt.Errorf("the key column `%s` is not found in the result", keyColumn)
+		}
+	}
+
+	buf := r.buffer(len(fields))
+	refs := buf.refs
+
+	if isScalarType(ptr.Type().Elem()) {
+		//基础类型,除了keyColumn外只能有一个字段
+		valueColumns := len(fields)
+		if keyIndex >= 0 {
+			valueColumns--
+		}
+
+		if valueColumns != 1 {
+			return nil, fmt.Errorf("the variable type is %v, the result must have exactly one column", ptr.Type().Elem())
+		}
+
+		var ref interface{} = ptr.Interface()
+		if conv, elem := lookupConverter(ptr.Type().Elem()); conv != nil {
+			ref = &converterScanner{dest: ptr.Elem(), conv: conv, elem: elem}
+		}
+
+		for i := range fields {
+			if i == keyIndex {
+				refs[i] = buf.sinks[i]
+			} else {
+				refs[i] = ref
+			}
+		}
+	} else {
+		plan, err := r.planFor(ptr.Type().Elem(), fields)
+		if err != nil {
+			return nil, err
+		}
+
+		if r.strict {
+			if err := plan.check(keyColumn); err != nil {
+				r.lastError = err
+				return nil, err
+			}
+		}
+
+		st := ptr.Elem()
+		for i, f := range plan.fields {
+			switch {
+			case f == nil:
+				refs[i] = buf.sinks[i]
+			case f.json:
+				refs[i] = &jsonScanner{dest: fieldByPath(st, f.index)}
+			case f.converter != nil:
+				refs[i] = &converterScanner{dest: fieldByPath(st, f.index), conv: f.converter, elem: f.converterElem}
+			default:
+				//如果对应的字段在结构体中有映射，则使用结构体成员变量的地址
+				refs[i] = fieldByPath(st, f.index).Addr().Interface()
+			}
+		}
+	}
+
+	if err := r.scan(refs...); err != nil {
+		return nil, err
+	}
+
+	if keyIndex >= 0 {
+		key = scannedValue(refs[keyIndex])
+	}
 
+	return key, nil
 }
@@ -0,0 +1,111 @@
+package kdb
+
+import (
+	"database/sql/driver"
+	"testing"
+)
+
+type testProfile struct {
+	Age int64 `db:"age"`
+}
+
+type testUser struct {
+	Id      int64   `db:"id"`
+	Name    *string `db:"name"`
+	Profile *testProfile
+}
+
+func setTestUsers() {
+	setTestRows([]string{"id", "name", "age"},
+		[]driver.Value{int64(1), "a", int64(10)},
+		[]driver.Value{int64(2), "b", int64(20)},
+	)
+}
+
+func TestRowsToStructAllocatesPerRow(t *testing.T) {
+	setupTestDB()
+	setTestUsers()
+
+	var users []testUser
+	if err := Table("user").Get().ToStruct(&users); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(users) != 2 {
+		t.Fatalf("got %d users, want 2", len(users))
+	}
+
+	if users[0].Profile == users[1].Profile || users[0].Name == users[1].Name {
+		t.Fatal("rows share the same nested pointer")
+	}
+
+	if users[0].Profile.Age != 10 || users[1].Profile.Age != 20 {
+		t.Fatalf("got ages %d and %d, want 10 and 20", users[0].Profile.Age, users[1].Profile.Age)
+	}
+
+	if *users[0].Name != "a" || *users[1].Name != "b" {
+		t.Fatalf("got names %s and %s, want a and b", *users[0].Name, *users[1].Name)
+	}
+}
+
+func TestRowsToStructPointerSlice(t *testing.T) {
+	setupTestDB()
+	setTestUsers()
+
+	var users []*testUser
+	if err := Table("user").Get().ToStruct(&users); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(users) != 2 || users[0] == users[1] || users[0].Profile == users[1].Profile {
+		t.Fatal("rows share the same struct")
+	}
+
+	if users[0].Id != 1 || users[1].Id != 2 || users[1].Profile.Age != 20 {
+		t.Fatalf("unexpected users %+v %+v", users[0], users[1])
+	}
+}
+
+func TestRowsScanAllocatesPerRow(t *testing.T) {
+	setupTestDB()
+	setTestUsers()
+
+	rows := Table("user").Get()
+	defer rows.Close()
+
+	var users []testUser
+	for rows.Next() {
+		var u testUser
+		if err := rows.Scan(&u); err != nil {
+			t.Fatal(err)
+		}
+		users = append(users, u)
+	}
+
+	if len(users) != 2 || users[0].Profile == users[1].Profile || users[0].Profile.Age != 10 {
+		t.Fatal("rows share the same nested pointer")
+	}
+}
+
+func TestRowsToMapPerRow(t *testing.T) {
+	setupTestDB()
+	setTestUsers()
+
+	items, err := Table("user").Get().ToMap()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(items) != 2 {
+		t.Fatalf("got %d items, want 2", len(items))
+	}
+
+	if items[0]["id"] != "1" || items[1]["id"] != "2" || items[0]["name"] != "a" || items[1]["name"] != "b" {
+		t.Fatalf("rows share the same map: %v", items)
+	}
+
+	items[0]["name"] = "c"
+	if items[1]["name"] != "b" {
+		t.Fatal("rows share the same map")
+	}
+}
@@ -0,0 +1,134 @@
+/**
+ * @Author : nopsky
+ * @Email : cnnopsky@gmail.com
+ * @Date : 2026/10/19 16:20
+ */
+package kdb
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+//插入数据并将插入的行扫描到dest中,dest支持的类型与Rows.ToStruct一致,columns为空时返回所有字段
+//postgres和sqlite使用returning,mysql在插入后根据自增id再查询一次
+func (b *Builder) InsertReturning(data interface{}, dest interface{}, columns ...string) error {
+	if b.grammar.dialect() == "mysql" {
+		var ids []int64
+		var err error
+
+		if reflect.Indirect(reflect.ValueOf(data)).Kind() == reflect.Slice {
+			ids, err = b.MultiInsert(data)
+		} else {
+			var id int64
+			id, err = b.Insert(data)
+			ids = []int64{id}
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if len(ids) == 0 {
+			return nil
+		}
+
+		return b.conn.Table(b.table).WhereIn(primaryKey, ids).OrderBy(primaryKey).Get(columns...).ToStruct(dest)
+	}
+
+	q, rows, bindingsArr, err := b.prepareBatchInsert(data)
+	if err != nil {
+		return err
+	}
+
+	for i, n := range rows {
+		sql := fmt.Sprintf("%s %s", strings.TrimSpace(q.grammar.compileBatchInsert(q, n)), q.grammar.compileReturning(columns))
+		if err := q.conn.Select(sql, bindingsArr[i]).ToStruct(dest); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//更新数据并将更新后的行扫描到dest中
+//mysql先查询出满足条件的主键,更新后再根据主键查询一次,在事务中使用时会对这些行加排他锁
+func (b *Builder) UpdateReturning(data interface{}, dest interface{}, columns ...string) error {
+	q, err := b.prepareUpdate(data)
+	if err != nil {
+		return err
+	}
+
+	if b.grammar.dialect() == "mysql" {
+		finder := b.Clone()
+		if b.conn.tx != nil {
+			finder.LockForUpdate()
+		}
+
+		result, err := finder.Pluck(fmt.Sprintf("%s.%s", b.table, primaryKey))
+		if err != nil {
+			return err
+		}
+
+		ids := result.([]string)
+		if len(ids) == 0 {
+			return nil
+		}
+
+		sql, err := q.grammar.compileUpdate(q)
+		if err != nil {
+			return err
+		}
+
+		if _, err := q.conn.Update(sql, q.getBindings()); err != nil {
+			return err
+		}
+
+		return b.conn.Table(b.table).WhereIn(primaryKey, ids).OrderBy(primaryKey).Get(columns...).ToStruct(dest)
+	}
+
+	sql, err := q.grammar.compileUpdate(q)
+	if err != nil {
+		return err
+	}
+
+	sql = fmt.Sprintf("%s %s", sql, q.grammar.compileReturning(columns))
+
+	return q.conn.Select(sql, q.getBindings()).ToStruct(dest)
+}
+
+//删除数据并将删除的行扫描到dest中
+//mysql在删除前先查询出满足条件的行,在事务中使用时会对这些行加排他锁
+func (b *Builder) DeleteReturning(dest interface{}, columns ...string) error {
+	if err := b.checkFullTable("delete"); err != nil {
+		return err
+	}
+
+	if b.grammar.dialect() == "mysql" {
+		finder := b.Clone()
+		if b.conn.tx != nil {
+			finder.LockForUpdate()
+		}
+
+		if len(columns) == 0 && len(b.joins) > 0 {
+			columns = []string{fmt.Sprintf("%s.*", b.table)}
+		}
+
+		if err := finder.Get(columns...).ToStruct(dest); err != nil {
+			return err
+		}
+
+		_, err := b.Delete()
+		return err
+	}
+
+	sql, err := b.grammar.compileDelete(b)
+	if err != nil {
+		return err
+	}
+
+	sql = fmt.Sprintf("%s %s", sql, b.grammar.compileReturning(columns))
+
+	return b.conn.Select(sql, b.getBindings()).ToStruct(dest)
+}
@@ -0,0 +1,110 @@
+/**
+ * @Author : nopsky
+ * @Email : cnnopsky@gmail.com
+ * @Date : 2026/10/19 17:45
+ */
+package kdb
+
+import (
+	"database/sql"
+)
+
+//带类型的查询,查询结果直接扫描为T
+type TypedQuery[T any] struct {
+	b *Builder
+}
+
+//创建带类型的查询,例如kdb.Query[user](kdb.Table("user").Where("status", 1)).All()
+func Query[T any](b *Builder) *TypedQuery[T] {
+	return &TypedQuery[T]{b: b}
+}
+
+//查询所有数据
+func (q *TypedQuery[T]) All() ([]T, error) {
+	result := make([]T, 0)
+	if err := q.b.Get().ToStruct(&result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+//查询第一条数据,没有数据时返回sql.ErrNoRows
+func (q *TypedQuery[T]) One() (T, error) {
+	var result T
+	err := q.b.First().ToStruct(&result)
+	return result, err
+}
+
+//逐行读取数据,使用完毕后需要调用Close
+func (q *TypedQuery[T]) Iter() *Iter[T] {
+	return &Iter[T]{rows: q.b.Get()}
+}
+
+//带类型的逐行迭代器
+type Iter[T any] struct {
+	rows    *Rows
+	current T
+	err     error
+}
+
+//读取下一行,没有数据或出错时返回false,并自动关闭结果集
+func (it *Iter[T]) Next() bool {
+	if it.err != nil {
+		return false
+	}
+
+	if !it.rows.Next() {
+		it.rows.Close()
+		return false
+	}
+
+	var current T
+	if err := it.rows.Scan(&current); err != nil {
+		it.err = err
+		it.rows.Close()
+		return false
+	}
+
+	it.current = current
+
+	return true
+}
+
+//当前行的数据
+func (it *Iter[T]) Value() T {
+	return it.current
+}
+
+func (it *Iter[T]) Err() error {
+	if it.err != nil {
+		return it.err
+	}
+	return it.rows.Err()
+}
+
+func (it *Iter[T]) Close() error {
+	return it.rows.Close()
+}
+
+//查询第一行中指定字段的值,例如kdb.Scalar[string](kdb.Table("user").Where("id", 1), "name")
+func Scalar[T any](b *Builder, column string) (T, error) {
+	var result T
+
+	rows := b.Clone().Limit(1).Get(column)
+	if rows.rs == nil {
+		return result, rows.lastError
+	}
+
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return result, err
+		}
+		return result, sql.ErrNoRows
+	}
+
+	err := rows.Scan(&result)
+
+	return result, err
+}